@@ -7,18 +7,39 @@ import (
 	"fmt"
 	"github.com/karpfediem/rx.nix/codegen/internal/ir"
 	"github.com/karpfediem/rx.nix/codegen/internal/mclgen"
+	"github.com/karpfediem/rx.nix/codegen/internal/parse"
+	"github.com/karpfediem/rx.nix/codegen/internal/selection"
 	"io"
 	"log"
 	"os"
 	"path/filepath"
 	"sort"
+	"strings"
 )
 
 func main() {
 	log.SetFlags(0)
 
 	inPath := flag.String("in", "-", "Input IR JSON file ('-' for stdin)")
+	format := flag.String("format", "ir", "Input format: ir, or nixos-dump for a JSON dump of NixOS configs (see internal/selection)")
 	outDir := flag.String("out", "", "Output directory for generated <host>.mcl files (required)")
+	host := flag.String("host", "", "Multi-host IR: render only this host, as main.mcl, resolving its collects against the other hosts' exports")
+	manifest := flag.String("manifest", "", "Optional resource manifest written by cmd/nixos; types params so maps and structs render as the right MCL literal")
+	var docOpts mclgen.DocumentOptions
+	flag.BoolVar(&docOpts.AllowLiteralSecrets, "allow-literal-secrets", false, "Render params that look sensitive (password, token, ...) even if they hold a literal instead of a __secret reference")
+	flag.BoolVar(&docOpts.Shared, "shared", false, "Multi-host IR: move statements common to all hosts into shared.mcl")
+	flag.BoolVar(&docOpts.Dispatch, "dispatch", false, "Multi-host IR: also write a main.mcl that includes the right host's class based on sys.hostname()")
+	flag.Func("group", "Multi-host IR: name=host1,host2 moves statements common to these hosts into shared-<name>.mcl (repeatable)", func(s string) error {
+		name, hosts, ok := strings.Cut(s, "=")
+		if !ok || name == "" || hosts == "" {
+			return fmt.Errorf("expected name=host1,host2")
+		}
+		if docOpts.Groups == nil {
+			docOpts.Groups = make(map[string][]string)
+		}
+		docOpts.Groups[name] = append(docOpts.Groups[name], strings.Split(hosts, ",")...)
+		return nil
+	})
 	flag.Parse()
 
 	if *outDir == "" {
@@ -28,48 +49,149 @@ func main() {
 		log.Fatalf("create out dir: %v", err)
 	}
 
+	if *manifest != "" {
+		resources, err := parse.ReadManifest(*manifest)
+		if err != nil {
+			log.Fatalf("read manifest: %v", err)
+		}
+		docOpts.Schema = mclgen.NewSchema(resources)
+	}
+
 	raw, err := readAll(*inPath)
 	if err != nil {
 		log.Fatalf("read IR: %v", err)
 	}
+
+	var (
+		single *ir.Host
+		doc    ir.Document
+	)
+	switch *format {
+	case "ir":
+		single, doc = decodeIR(raw)
+	case "nixos-dump":
+		single, doc = decodeNixOSDump(raw)
+	default:
+		log.Fatalf("unknown -format %q (expected ir or nixos-dump)", *format)
+	}
+
+	if single != nil {
+		if *host != "" {
+			log.Fatal("-host needs multi-host IR")
+		}
+		writeHost(*outDir, "main", *single, docOpts.RenderOptions)
+		writePayloads(*outDir, "main", *single)
+		return
+	}
+	if *host != "" {
+		data, err := mclgen.RenderDocumentHost(doc, *host, docOpts.RenderOptions)
+		if err != nil {
+			log.Fatalf("render host %q: %v", *host, err)
+		}
+		writeFile(*outDir, "main.mcl", data)
+		writePayloads(*outDir, *host, doc[*host])
+		return
+	}
+	rendered, err := mclgen.RenderDocument(doc, docOpts)
+	if err != nil {
+		log.Fatalf("render multi-host IR: %v", err)
+	}
+	names := make([]string, 0, len(rendered))
+	for k := range rendered {
+		names = append(names, k)
+	}
+	sort.Strings(names)
+	for _, fn := range names {
+		writeFile(*outDir, fn, rendered[fn])
+	}
+	for hn, h := range doc {
+		writePayloads(*outDir, hn, h)
+	}
+}
+
+func decodeIR(raw []byte) (*ir.Host, ir.Document) {
 	shape, err := detectShape(raw)
 	if err != nil {
 		log.Fatalf("detect IR shape: %v", err)
 	}
-
 	switch shape {
 	case irShapeSingle:
 		var h ir.Host
-		if err := json.Unmarshal(raw, &h); err != nil {
+		if err := ir.Decode(raw, &h); err != nil {
 			log.Fatalf("decode single-host IR: %v", err)
 		}
-		writeHost(*outDir, "main", h)
-
+		return &h, nil
 	case irShapeMulti:
 		var doc ir.Document
-		if err := json.Unmarshal(raw, &doc); err != nil {
+		if err := ir.Decode(raw, &doc); err != nil {
 			log.Fatalf("decode multi-host IR: %v", err)
 		}
-		hosts := make([]string, 0, len(doc))
-		for k := range doc {
-			hosts = append(hosts, k)
+		return nil, doc
+	}
+	log.Fatalf("unsupported IR JSON: expected object")
+	return nil, nil
+}
+
+// decodeNixOSDump runs the file/systemd selection on a dump of one NixOS
+// configuration, or on a map of host name to dump.
+func decodeNixOSDump(raw []byte) (*ir.Host, ir.Document) {
+	probe, err := probeObject(raw)
+	if err != nil {
+		log.Fatalf("detect dump shape: %v", err)
+	}
+	if selection.IsDump(probe) {
+		d, err := selection.DecodeDump(raw)
+		if err != nil {
+			log.Fatalf("decode NixOS dump: %v", err)
 		}
-		sort.Strings(hosts)
-		for _, hn := range hosts {
-			writeHost(*outDir, hn, doc[hn])
+		h, err := selection.HostIR(d)
+		if err != nil {
+			log.Fatalf("select: %v", err)
 		}
-
-	default:
-		log.Fatalf("unsupported IR JSON: expected object")
+		return &h, nil
 	}
+	var dumps map[string]json.RawMessage
+	if err := json.Unmarshal(raw, &dumps); err != nil {
+		log.Fatalf("decode NixOS dumps: %v", err)
+	}
+	doc := make(ir.Document, len(dumps))
+	for hn, r := range dumps {
+		d, err := selection.DecodeDump(r)
+		if err != nil {
+			log.Fatalf("decode NixOS dump for host %q: %v", hn, err)
+		}
+		if doc[hn], err = selection.HostIR(d); err != nil {
+			log.Fatalf("select host %q: %v", hn, err)
+		}
+	}
+	return nil, doc
 }
 
-func writeHost(outDir, host string, h ir.Host) {
-	data, err := mclgen.RenderHost(host, h)
+func writeHost(outDir, host string, h ir.Host, opts mclgen.RenderOptions) {
+	data, err := mclgen.RenderHost(host, h, opts)
 	if err != nil {
 		log.Fatalf("render host %q: %v", host, err)
 	}
-	fn := filepath.Join(outDir, host+".mcl")
+	writeFile(outDir, host+".mcl", data)
+}
+
+// writePayloads copies the encrypted secrets a host references into the
+// deploy, still encrypted.
+func writePayloads(outDir, host string, h ir.Host) {
+	payloads, err := mclgen.SecretPayloads(h)
+	if err != nil {
+		log.Fatalf("host %q: %v", host, err)
+	}
+	for name, data := range payloads {
+		writeFile(outDir, name, data)
+	}
+}
+
+func writeFile(outDir, name string, data []byte) {
+	fn := filepath.Join(outDir, name)
+	if err := os.MkdirAll(filepath.Dir(fn), 0o755); err != nil {
+		log.Fatalf("create %s: %v", filepath.Dir(fn), err)
+	}
 	if err := os.WriteFile(fn, data, 0o644); err != nil {
 		log.Fatalf("write %s: %v", fn, err)
 	}
@@ -91,32 +213,31 @@ const (
 )
 
 func detectShape(raw []byte) (irShape, error) {
+	probe, err := probeObject(raw)
+	if err != nil {
+		return irShapeUnknown, err
+	}
+	if ir.IsDocument(probe) {
+		return irShapeMulti, nil
+	}
+	return irShapeSingle, nil
+}
+
+func probeObject(raw []byte) (map[string]any, error) {
 	// Must be a JSON object at top level
 	i := 0
 	for i < len(raw) && (raw[i] == ' ' || raw[i] == '\n' || raw[i] == '\t' || raw[i] == '\r') {
 		i++
 	}
 	if i >= len(raw) || raw[i] != '{' {
-		return irShapeUnknown, fmt.Errorf("top-level JSON must be an object")
+		return nil, fmt.Errorf("top-level JSON must be an object")
 	}
 	// Probe minimal shape
 	var probe map[string]any
 	dec := json.NewDecoder(bytes.NewReader(raw))
 	dec.UseNumber()
 	if err := dec.Decode(&probe); err != nil {
-		return irShapeUnknown, err
-	}
-	if hasAny(probe, "imports", "res", "raw", "vars") {
-		return irShapeSingle, nil
-	}
-	return irShapeMulti, nil
-}
-
-func hasAny(m map[string]any, keys ...string) bool {
-	for _, k := range keys {
-		if _, ok := m[k]; ok {
-			return true
-		}
+		return nil, err
 	}
-	return false
+	return probe, nil
 }
@@ -0,0 +1,284 @@
+package main
+
+import (
+	"fmt"
+	"github.com/karpfediem/rx.nix/codegen/internal/mclparse"
+	"github.com/karpfediem/rx.nix/codegen/internal/nixgen"
+	"github.com/karpfediem/rx.nix/codegen/internal/parse"
+	"github.com/karpfediem/rx.nix/codegen/internal/util"
+	"regexp"
+	"slices"
+	"sort"
+	"strings"
+)
+
+// module collects the rx.* definitions converted from one MCL file.
+type module struct {
+	imports []string
+	vars    map[string]string                    // name -> MCL expression
+	res     map[string]map[string]map[string]any // kind -> name -> param -> value
+	export  map[string]map[string][]any          // kind -> name -> hosts
+	raw     []rawBlock
+}
+
+type rawBlock struct {
+	reason string
+	src    string
+}
+
+// converter turns MCL statements into rx.* definitions. If resources is not
+// nil, kinds and params are checked against the generated rx.res options.
+type converter struct {
+	resources map[string]parse.ResourceInfo
+	m         module
+}
+
+func newConverter(resources []parse.ResourceInfo) *converter {
+	c := &converter{m: module{
+		vars:   make(map[string]string),
+		res:    make(map[string]map[string]map[string]any),
+		export: make(map[string]map[string][]any),
+	}}
+	if resources != nil {
+		c.resources = make(map[string]parse.ResourceInfo, len(resources))
+		for _, r := range resources {
+			c.resources[r.Name] = r
+		}
+	}
+	return c
+}
+
+func (c *converter) convert(f *mclparse.File) {
+	for _, s := range f.Stmts {
+		if reason := c.stmt(s); reason != "" {
+			c.m.raw = append(c.m.raw, rawBlock{reason: reason, src: s.Source()})
+		}
+	}
+}
+
+// stmt converts a single statement, returning why it has to stay raw MCL.
+func (c *converter) stmt(s mclparse.Stmt) string {
+	switch x := s.(type) {
+	case *mclparse.Import:
+		if x.Alias != "" {
+			return fmt.Sprintf("import %q uses an alias, which rx.mcl.imports cannot express", x.Path)
+		}
+		if !slices.Contains(c.m.imports, x.Path) {
+			c.m.imports = append(c.m.imports, x.Path)
+		}
+		return ""
+	case *mclparse.Bind:
+		if _, dup := c.m.vars[x.Name]; dup {
+			return fmt.Sprintf("$%s is bound more than once", x.Name)
+		}
+		c.m.vars[x.Name] = x.Value.Source()
+		return ""
+	case *mclparse.Resource:
+		return c.resource(x)
+	}
+	return fmt.Sprintf("%s is not an import, variable binding or resource", describeOther(s.Source()))
+}
+
+func (c *converter) resource(r *mclparse.Resource) string {
+	name, ok := r.Name.(*mclparse.String)
+	if !ok || name.Interpolated {
+		return fmt.Sprintf("%s resource name %s is not a plain string literal", r.Kind, r.Name.Source())
+	}
+	var info *parse.ResourceInfo
+	if c.resources != nil {
+		ri, ok := c.resources[r.Kind]
+		if !ok {
+			return fmt.Sprintf("resource kind %q is not generated under rx.res", r.Kind)
+		}
+		info = &ri
+	}
+	kind := util.SanitizeAttrIdent(r.Kind)
+	if _, dup := c.m.res[kind][name.Value]; dup {
+		return fmt.Sprintf("%s %q is defined more than once", r.Kind, name.Value)
+	}
+
+	params := make(map[string]any, len(r.Fields))
+	var export []any
+	for _, f := range r.Fields {
+		v, err := mclparse.Value(f.Value)
+		if err != nil {
+			return fmt.Sprintf("param %s is not static (%v)", f.Key, err)
+		}
+		if f.Key == "Meta:export" {
+			hosts, ok := v.([]any)
+			if !ok || !allStrings(hosts) {
+				return "Meta:export is not a list of host names"
+			}
+			export = hosts
+			continue
+		}
+		if strings.Contains(f.Key, ":") || f.Key != strings.ToLower(f.Key) {
+			return fmt.Sprintf("param %s is a metaparam or edge, which rx.res cannot express", f.Key)
+		}
+		field := findField(info, f.Key)
+		if info != nil && field == nil {
+			return fmt.Sprintf("param %s is not an option of rx.res.%s", f.Key, kind)
+		}
+		typed := field != nil && strings.HasPrefix(field.GoType, "map[")
+		if m := structLikeMap(f.Value, typed); m != nil {
+			return fmt.Sprintf("param %s holds the map %s, which would read back as a struct without its Go type (pass -mgmt-dir)", f.Key, m.Source())
+		}
+		params[util.SanitizeAttrIdent(f.Key)] = v
+	}
+
+	if c.m.res[kind] == nil {
+		c.m.res[kind] = make(map[string]map[string]any)
+	}
+	c.m.res[kind][name.Value] = params
+	if len(export) > 0 {
+		if c.m.export[kind] == nil {
+			c.m.export[kind] = make(map[string][]any)
+		}
+		c.m.export[kind][name.Value] = export
+	}
+	return ""
+}
+
+// findField returns the field of r with the MCL name lang, or nil if there
+// is none or r is not known.
+func findField(r *parse.ResourceInfo, lang string) *parse.FieldInfo {
+	if r == nil {
+		return nil
+	}
+	for i, f := range r.Fields {
+		if f.LangName == lang {
+			return &r.Fields[i]
+		}
+	}
+	return nil
+}
+
+// structKey matches the map keys that rendering an untyped attribute set
+// takes for struct fields.
+var structKey = regexp.MustCompile(`^[a-z][a-z0-9_]*$`)
+
+// structLikeMap returns the first map literal in e, other than e itself if
+// typed, that an attribute set would not bring back as a map: one whose keys
+// could all be struct fields. Such maps are only told apart from structs by
+// the param's Go type.
+func structLikeMap(e mclparse.Expr, typed bool) *mclparse.Map {
+	switch x := e.(type) {
+	case *mclparse.List:
+		for _, el := range x.Elems {
+			if m := structLikeMap(el, false); m != nil {
+				return m
+			}
+		}
+	case *mclparse.Struct:
+		for _, f := range x.Fields {
+			if m := structLikeMap(f.Value, false); m != nil {
+				return m
+			}
+		}
+	case *mclparse.Map:
+		if !typed && len(x.Entries) > 0 && !slices.ContainsFunc(x.Entries, func(en mclparse.MapEntry) bool {
+			k, ok := en.Key.(*mclparse.String)
+			return !ok || !structKey.MatchString(k.Value)
+		}) {
+			return x
+		}
+		for _, en := range x.Entries {
+			if m := structLikeMap(en.Value, false); m != nil {
+				return m
+			}
+		}
+	}
+	return nil
+}
+
+func allStrings(vs []any) bool {
+	for _, v := range vs {
+		if _, ok := v.(string); !ok {
+			return false
+		}
+	}
+	return true
+}
+
+// describeOther names a statement by its leading keyword for raw comments.
+func describeOther(src string) string {
+	word := src
+	if i := strings.IndexAny(word, " \t\n({[\"$"); i >= 0 {
+		word = word[:i]
+	}
+	switch word {
+	case "if", "class", "include", "func", "collect", "for", "forkv", "panic":
+		return "`" + word + "` statement"
+	}
+	if strings.Contains(src, "->") {
+		return "edge statement"
+	}
+	return "statement"
+}
+
+// render renders the converted module as a NixOS module.
+func (m module) render(source string) string {
+	var b strings.Builder
+	fmt.Fprintf(&b, "# Converted from MCL by mcl2nix (%s).\n", source)
+	fmt.Fprintf(&b, "{ ... }:\n{\n")
+	var sections []string
+
+	if len(m.imports) > 0 {
+		imps := make([]any, len(m.imports))
+		for i, s := range m.imports {
+			imps[i] = s
+		}
+		sections = append(sections, fmt.Sprintf("  rx.mcl.imports = %s;\n", nixgen.Literal(imps, 1)))
+	}
+	if len(m.vars) > 0 {
+		vars := make(map[string]any, len(m.vars))
+		for k, v := range m.vars {
+			vars[k] = v
+		}
+		sections = append(sections, fmt.Sprintf("  rx.mcl.vars = %s;\n", nixgen.Literal(vars, 1)))
+	}
+	for _, kind := range sortedKeys(m.res) {
+		var s strings.Builder
+		for _, name := range sortedKeys(m.res[kind]) {
+			fmt.Fprintf(&s, "  rx.res.%s.%s = %s;\n", util.NixAttrName(kind), util.NixAttrName(name), nixgen.Literal(m.res[kind][name], 1))
+		}
+		sections = append(sections, s.String())
+	}
+	for _, kind := range sortedKeys(m.export) {
+		var s strings.Builder
+		for _, name := range sortedKeys(m.export[kind]) {
+			fmt.Fprintf(&s, "  rx.export.%s.%s = %s;\n", util.NixAttrName(kind), util.NixAttrName(name), nixgen.Literal(m.export[kind][name], 1))
+		}
+		sections = append(sections, s.String())
+	}
+	if len(m.raw) > 0 {
+		var s strings.Builder
+		s.WriteString("  rx.mcl.raw = [\n")
+		for _, r := range m.raw {
+			fmt.Fprintf(&s, "    # Kept as raw MCL: %s.\n", r.reason)
+			s.WriteString("    ''\n")
+			for _, line := range strings.Split(util.EscapeIndentedNix(r.src), "\n") {
+				if line == "" {
+					s.WriteString("\n")
+					continue
+				}
+				s.WriteString("      " + line + "\n")
+			}
+			s.WriteString("    ''\n")
+		}
+		s.WriteString("  ];\n")
+		sections = append(sections, s.String())
+	}
+	b.WriteString(strings.Join(sections, "\n"))
+	b.WriteString("}\n")
+	return b.String()
+}
+
+func sortedKeys[V any](m map[string]V) []string {
+	keys := make([]string, 0, len(m))
+	for k := range m {
+		keys = append(keys, k)
+	}
+	sort.Strings(keys)
+	return keys
+}
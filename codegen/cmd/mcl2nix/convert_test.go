@@ -0,0 +1,91 @@
+package main
+
+import (
+	"github.com/karpfediem/rx.nix/codegen/internal/ir"
+	"github.com/karpfediem/rx.nix/codegen/internal/mclgen"
+	"github.com/karpfediem/rx.nix/codegen/internal/mclparse"
+	"github.com/karpfediem/rx.nix/codegen/internal/parse"
+	"github.com/karpfediem/rx.nix/codegen/internal/testutil"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+func convertFile(t *testing.T, path string, resources []parse.ResourceInfo) string {
+	t.Helper()
+	src, err := os.ReadFile(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	f, err := mclparse.Parse(string(src))
+	if err != nil {
+		t.Fatal(err)
+	}
+	c := newConverter(resources)
+	c.convert(f)
+	return c.m.render(filepath.Base(path))
+}
+
+// Each testdata/<name>.mcl converts to testdata/<name>.nix.golden, covering
+// imports, vars, exports and the statements that are kept as raw MCL.
+func TestConvertGolden(t *testing.T) {
+	paths, err := filepath.Glob("testdata/*.mcl")
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, path := range paths {
+		t.Run(filepath.Base(path), func(t *testing.T) {
+			got := convertFile(t, path, nil)
+			testutil.Golden(t, strings.TrimSuffix(path, ".mcl")+".nix.golden", []byte(got))
+		})
+	}
+}
+
+// The MCL examples of the mgmt fixture convert, with kinds and params
+// checked against its resources.
+func TestConvertMgmtExamples(t *testing.T) {
+	resources, _, err := parse.ParseResources(testutil.MgmtFixture, parse.Options{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	got := convertFile(t, filepath.Join(testutil.MgmtFixture, parse.ExamplesDir, "file0.mcl"), resources)
+	testutil.Golden(t, "testdata/file0.nix.golden", []byte(got))
+}
+
+// A map param comes back from the IR as an MCL map: through its Go type if
+// the resources are known, and not at all, as raw MCL, if they aren't.
+func TestConvertMapRoundTrip(t *testing.T) {
+	resources, _, err := parse.ParseResources(testutil.MgmtFixture, parse.Options{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	f, err := mclparse.Parse(`test:exotic "x" {
+	env => {"abc" => "1",},
+}
+`)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	c := newConverter(resources)
+	c.convert(f)
+	params, ok := c.m.res["test-exotic"]["x"]
+	if !ok || len(c.m.raw) != 0 {
+		t.Fatalf("test:exotic was not converted: %+v", c.m.raw)
+	}
+	h := ir.Host{Res: map[string]map[string]map[string]any{"test:exotic": {"x": params}}}
+	out, err := mclgen.RenderHost("demo", h, mclgen.RenderOptions{Schema: mclgen.NewSchema(resources)})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if want := `"abc" => "1",`; !strings.Contains(string(out), want) {
+		t.Errorf("env does not render as a map with %s:\n%s", want, out)
+	}
+
+	c = newConverter(nil)
+	c.convert(f)
+	if len(c.m.raw) != 1 || len(c.m.res) != 0 {
+		t.Errorf("untyped map param converted to %+v, want it kept raw", c.m.res)
+	}
+}
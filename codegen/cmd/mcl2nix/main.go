@@ -0,0 +1,67 @@
+package main
+
+import (
+	"flag"
+	"github.com/karpfediem/rx.nix/codegen/internal/mclparse"
+	"github.com/karpfediem/rx.nix/codegen/internal/parse"
+	"io"
+	"log"
+	"os"
+)
+
+func main() {
+	log.SetFlags(0)
+
+	inPath := flag.String("in", "-", "Input MCL file ('-' for stdin)")
+	outPath := flag.String("out", "-", "Output .nix file ('-' for stdout)")
+	mgmtDir := flag.String("mgmt-dir", "", "Optional mgmt source root; if set, resource kinds and params are checked against the generated rx.res options")
+	tags := flag.String("tags", "", "Comma-separated build tags of the mgmt binary, for -mgmt-dir")
+	flag.Parse()
+
+	src, err := readAll(*inPath)
+	if err != nil {
+		log.Fatalf("read MCL: %v", err)
+	}
+	f, err := mclparse.Parse(string(src))
+	if err != nil {
+		log.Fatalf("parse MCL: %v", err)
+	}
+
+	var resources []parse.ResourceInfo
+	if *mgmtDir != "" {
+		var diags []parse.Diagnostic
+		resources, diags, err = parse.ParseResources(*mgmtDir, parse.Options{Tags: parse.SplitTags(*tags)})
+		for _, d := range diags {
+			log.Printf("warning: %s", d)
+		}
+		if err != nil {
+			log.Fatalf("parse resources: %v", err)
+		}
+	}
+	c := newConverter(resources)
+	c.convert(f)
+
+	name := *inPath
+	if name == "-" || name == "" {
+		name = "stdin"
+	}
+	out := c.m.render(name)
+	if *outPath == "-" || *outPath == "" {
+		_, err = io.WriteString(os.Stdout, out)
+	} else {
+		err = os.WriteFile(*outPath, []byte(out), 0o644)
+	}
+	if err != nil {
+		log.Fatalf("write Nix: %v", err)
+	}
+	for _, r := range c.m.raw {
+		log.Printf("kept as raw MCL: %s", r.reason)
+	}
+}
+
+func readAll(path string) ([]byte, error) {
+	if path == "-" || path == "" {
+		return io.ReadAll(os.Stdin)
+	}
+	return os.ReadFile(path)
+}
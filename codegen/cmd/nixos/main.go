@@ -1,6 +1,7 @@
 package main
 
 import (
+	"errors"
 	"flag"
 	"fmt"
 	"github.com/karpfediem/rx.nix/codegen/internal/nixgen"
@@ -17,27 +18,78 @@ func main() {
 	log.SetFlags(0)
 	mgmtDir := flag.String("mgmt-dir", "", "Path to mgmt source root (repo checkout)")
 	outDir := flag.String("out-dir", "", "Directory to write generated .nix files into")
+	tags := flag.String("tags", "", "Comma-separated build tags of the mgmt binary, e.g. novirt,nodocker; $GOOS and $GOARCH select the platform (default linux/amd64)")
+	typeCheck := flag.Bool("typecheck", false, "Resolve field types with go/types; the mgmt tree's dependencies must be vendored or in its module cache")
+	strict := flag.Bool("strict", false, "Fail if the mgmt source has anything the parser skipped or could only approximate")
+	docsDir := flag.String("docs-dir", "", "Directory to write the Markdown option reference into (default <out-dir>/docs)")
 	flag.Parse()
 
 	if *mgmtDir == "" || *outDir == "" {
 		log.Fatal("usage: nixos -mgmt-dir /path/to/mgmt -out-dir /path/to/out")
 	}
-	if err := os.MkdirAll(*outDir, 0o755); err != nil {
-		log.Fatalf("creating out dir: %v", err)
+	if *docsDir == "" {
+		*docsDir = filepath.Join(*outDir, "docs")
+	}
+	for _, dir := range []string{*outDir, *docsDir} {
+		if err := os.MkdirAll(dir, 0o755); err != nil {
+			log.Fatalf("creating %s: %v", dir, err)
+		}
 	}
 
-	resources, err := parse.ParseResources(*mgmtDir)
+	opts := parse.Options{Tags: parse.SplitTags(*tags), TypeCheck: *typeCheck}
+	resources, diags, err := parse.ParseResources(*mgmtDir, opts)
 	if err != nil {
+		for _, d := range diags {
+			log.Printf("warning: %s", d)
+		}
 		log.Fatalf("parse resources: %v", err)
 	}
+	funcs, funcDiags, err := parse.ParseFunctions(*mgmtDir, opts)
+	diags = append(diags, funcDiags...)
+	for _, d := range diags {
+		log.Printf("warning: %s", d)
+	}
+	// A tree without functions still has resources; rx.lib.fn is left out.
+	withFuncs := !errors.Is(err, parse.ErrNoFuncs)
+	if !withFuncs {
+		log.Printf("warning: %v; not generating rx.lib.fn", err)
+	} else if err != nil {
+		log.Fatalf("parse functions: %v", err)
+	}
+	if *strict && len(diags) > 0 {
+		log.Fatalf("%d parse diagnostics; not generating anything because of -strict", len(diags))
+	}
 
+	refs := nixgen.NewRefs(resources)
 	var generated []string
 	for _, r := range resources {
 		fn := filepath.Join(*outDir, "res-"+util.SanitizeAttrIdent(strings.ToLower(r.Name))+".nix")
-		if err := nixgen.WriteResourceNix(fn, r); err != nil {
+		if err := nixgen.WriteResourceNix(fn, r, refs); err != nil {
 			log.Fatalf("write %s: %v", fn, err)
 		}
 		generated = append(generated, filepath.Base(fn))
+
+		doc := filepath.Join(*docsDir, nixgen.DocFile(r))
+		if err := nixgen.WriteResourceDoc(doc, r, refs); err != nil {
+			log.Fatalf("write %s: %v", doc, err)
+		}
+	}
+	if err := nixgen.WriteDocIndex(filepath.Join(*docsDir, "README.md"), resources); err != nil {
+		log.Fatalf("write docs index: %v", err)
+	}
+
+	if err := parse.WriteManifest(filepath.Join(*outDir, parse.ManifestFile), resources); err != nil {
+		log.Fatalf("write manifest: %v", err)
+	}
+
+	if withFuncs {
+		if err := nixgen.WriteFuncNix(filepath.Join(*outDir, nixgen.FuncNixFile), funcs); err != nil {
+			log.Fatalf("write %s: %v", nixgen.FuncNixFile, err)
+		}
+		generated = append(generated, nixgen.FuncNixFile)
+		if err := parse.WriteFuncManifest(filepath.Join(*outDir, parse.FuncManifestFile), funcs); err != nil {
+			log.Fatalf("write function manifest: %v", err)
+		}
 	}
 
 	sort.Strings(generated)
@@ -45,5 +97,5 @@ func main() {
 		log.Fatalf("write default.nix: %v", err)
 	}
 
-	fmt.Printf("Generated %d resource modules into %s\n", len(generated), *outDir)
+	fmt.Printf("Generated %d resource modules and %d functions into %s\n", len(resources), len(funcs), *outDir)
 }
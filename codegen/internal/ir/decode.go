@@ -0,0 +1,47 @@
+package ir
+
+import (
+	"bytes"
+	"encoding/json"
+)
+
+// Decode decodes IR JSON into v, a *Host or *Document. Numbers are kept as
+// json.Number, so integers beyond float64 precision and the int/float
+// distinction survive until rendering.
+func Decode(raw []byte, v any) error {
+	dec := json.NewDecoder(bytes.NewReader(raw))
+	dec.UseNumber()
+	return dec.Decode(v)
+}
+
+// hostKeys are the keys of a Host in IR JSON.
+var hostKeys = map[string]bool{
+	"imports": true, "vars": true, "raw": true, "res": true,
+	"hostname": true, "export": true, "collect": true, "secretKey": true,
+}
+
+// IsDocument reports whether a decoded top-level IR object is a Document
+// rather than a single Host. It goes by the values, since hosts may well be
+// named export or hostname: every value of a Document is an object of Host
+// keys, while a Host holds lists and strings, and objects keyed by kinds and
+// names.
+func IsDocument(probe map[string]any) bool {
+	return objectsOf(probe, hostKeys)
+}
+
+// objectsOf reports whether every value of m is an object whose keys are
+// all in keys.
+func objectsOf(m map[string]any, keys map[string]bool) bool {
+	for _, v := range m {
+		obj, ok := v.(map[string]any)
+		if !ok {
+			return false
+		}
+		for k := range obj {
+			if !keys[k] {
+				return false
+			}
+		}
+	}
+	return true
+}
@@ -0,0 +1,26 @@
+package ir
+
+import (
+	"encoding/json"
+	"testing"
+)
+
+// A Document is told from a Host by its values, so hosts may be named like
+// Host keys.
+func TestIsDocument(t *testing.T) {
+	for doc, want := range map[string]bool{
+		`{"imports": ["deploy"], "res": {"file": {}}}`:                          false,
+		`{"res": {"file": {"/a": {}}}, "vars": {"x": 1}}`:                       false,
+		`{"web": {"res": {}}, "db": {"imports": []}}`:                           true,
+		`{"export": {"res": {}}, "hostname": {"hostname": "h"}, "collect": {}}`: true,
+		`{}`: true,
+	} {
+		var probe map[string]any
+		if err := json.Unmarshal([]byte(doc), &probe); err != nil {
+			t.Fatal(err)
+		}
+		if got := IsDocument(probe); got != want {
+			t.Errorf("IsDocument(%s) = %v, want %v", doc, got, want)
+		}
+	}
+}
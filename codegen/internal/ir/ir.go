@@ -5,6 +5,29 @@ type Host struct {
 	Vars    map[string]any                       `json:"vars"`
 	Raw     []string                             `json:"raw"`
 	Res     map[string]map[string]map[string]any `json:"res"`
+
+	// Hostname is the name the host reports via sys.hostname(), used when a
+	// whole document is dispatched from a single main.mcl. Defaults to the
+	// host's key in the Document.
+	Hostname string `json:"hostname,omitempty"`
+
+	// Export maps kind -> resource name -> hosts the resource is exported to
+	// ("*" exports to every host). Rendered as the Meta:export metaparam.
+	Export map[string]map[string][]string `json:"export,omitempty"`
+	// Collect lists resources exported by other hosts that this host collects.
+	Collect []Collect `json:"collect,omitempty"`
+
+	// SecretKey is the path of the host's key for decrypting secrets that
+	// ship encrypted in the deploy (rx.mgmt.secretKeyFile).
+	SecretKey string `json:"secretKey,omitempty"`
+}
+
+// Collect declares that a host collects resources of Kind exported by others.
+type Collect struct {
+	Kind   string         `json:"kind"`
+	Name   string         `json:"name,omitempty"`   // empty: every exported name of Kind
+	From   []string       `json:"from,omitempty"`   // empty: any exporting host
+	Params map[string]any `json:"params,omitempty"` // params applied to the collected resources
 }
 
 // Top-level: map[hostname]Host
@@ -0,0 +1,53 @@
+package mclgen
+
+import (
+	"fmt"
+	"strings"
+)
+
+// callTag marks an IR value that is a call of an mgmt function, as built by
+// rx.lib.fn, e.g. {"__call": {"module": "datetime", "name": "now", "args":
+// [], "type": "int"}}. Core functions have no module.
+const callTag = "__call"
+
+// callRef returns the call held by v, if v is a call node.
+func callRef(v any) (map[string]any, bool) {
+	m, ok := v.(map[string]any)
+	if !ok || len(m) != 1 {
+		return nil, false
+	}
+	c, ok := m[callTag].(map[string]any)
+	return c, ok
+}
+
+// renderCall renders a call through the name its module is imported as,
+// which is the last element of the module path, e.g. strings.to_upper(...)
+// for golang/strings.
+func renderCall(c map[string]any, indentLevel int) (string, error) {
+	module, _ := c["module"].(string)
+	name, _ := c["name"].(string)
+	if !isIdent(name) {
+		return "", fmt.Errorf("%s: function name %q is not a valid MCL identifier", callTag, name)
+	}
+	fn := name
+	if module != "" {
+		alias := module[strings.LastIndex(module, "/")+1:]
+		if !isIdent(alias) {
+			return "", fmt.Errorf("%s: module %q does not end in a valid MCL identifier", callTag, module)
+		}
+		fn = alias + "." + name
+	}
+	args, ok := c["args"].([]any)
+	if !ok && c["args"] != nil {
+		return "", fmt.Errorf("%s: %s: args must be a list", callTag, fn)
+	}
+	lits := make([]string, len(args))
+	for i, arg := range args {
+		lit, err := renderValue(arg, nil, indentLevel)
+		if err != nil {
+			return "", fmt.Errorf("%s: argument %d: %w", fn, i+1, err)
+		}
+		lits[i] = lit
+	}
+	return fn + "(" + strings.Join(lits, ", ") + ")", nil
+}
@@ -0,0 +1,31 @@
+package mclgen
+
+import (
+	"fmt"
+	"strings"
+)
+
+// constTag marks an IR value that is one of mgmt's built-in constants, as
+// given by rx.const, e.g. {"__const": {"name": "res.file.state.exists",
+// "type": "str"}} for $const.res.file.state.exists.
+const constTag = "__const"
+
+// constRef returns the constant held by v, if v is a constant node.
+func constRef(v any) (map[string]any, bool) {
+	m, ok := v.(map[string]any)
+	if !ok || len(m) != 1 {
+		return nil, false
+	}
+	c, ok := m[constTag].(map[string]any)
+	return c, ok
+}
+
+func renderConst(c map[string]any) (string, error) {
+	name, _ := c["name"].(string)
+	for _, part := range strings.Split(name, ".") {
+		if !isIdent(part) {
+			return "", fmt.Errorf("%s: %q is not a dotted MCL identifier", constTag, name)
+		}
+	}
+	return "$const." + name, nil
+}
@@ -0,0 +1,170 @@
+package mclgen
+
+import (
+	"bytes"
+	"fmt"
+	"github.com/karpfediem/rx.nix/codegen/internal/ir"
+	"strings"
+)
+
+// DispatchFile is the deploy entry point written in dispatch mode.
+const DispatchFile = "main.mcl"
+
+// RenderDocument renders every host of a multi-host document, keyed by file
+// name relative to the deploy directory (<host>.mcl, plus any shared modules
+// and the dispatching main.mcl requested by opts). Collect declarations are
+// resolved against the exports of the other hosts, and the document is
+// rejected if CheckExchange finds a problem.
+func RenderDocument(doc ir.Document, opts DocumentOptions) (map[string][]byte, error) {
+	if err := CheckExchange(doc); err != nil {
+		return nil, err
+	}
+	groups, err := sharedGroups(doc, opts)
+	if err != nil {
+		return nil, err
+	}
+	var aliases map[string]string
+	if opts.Dispatch {
+		if aliases, err = hostAliases(doc); err != nil {
+			return nil, err
+		}
+		classes := make(map[string]string, len(groups))
+		for _, g := range groups {
+			class := mclIdent(strings.TrimSuffix(g.file, ".mcl"))
+			if other, ok := classes[class]; ok {
+				return nil, fmt.Errorf("%s and %s map to the same class name %s", other, g.file, class)
+			}
+			classes[class] = g.file
+		}
+	}
+	files := make(map[string]*mclFile, len(doc))
+	for _, hn := range sortedKeysMap(doc) {
+		f, err := hostFile(hn, exportsByHostname(doc, doc[hn]), documentSources(doc), opts.RenderOptions)
+		if err != nil {
+			return nil, fmt.Errorf("render host %q: %w", hn, err)
+		}
+		if opts.Dispatch {
+			f.class = "host"
+		}
+		files[hn] = f
+	}
+
+	out := make(map[string][]byte, len(doc)+len(groups)+1)
+	for _, g := range groups {
+		members := make([]*mclFile, len(g.hosts))
+		for i, hn := range g.hosts {
+			members[i] = files[hn]
+		}
+		shared := extractShared(members)
+		if shared == nil {
+			continue
+		}
+		if opts.Dispatch {
+			// Imported modules are part of every node's graph, so shared
+			// resources must only be instantiated from the host classes.
+			shared.class = mclIdent(strings.TrimSuffix(g.file, ".mcl"))
+		}
+		if out[g.file], err = shared.render(fmt.Sprintf("Generated shared MCL for hosts %q", g.hosts)); err != nil {
+			return nil, fmt.Errorf("render %s: %w", g.file, err)
+		}
+		for _, f := range members {
+			f.modules = append(f.modules, g.file)
+			if shared.class != "" {
+				f.includes = append(f.includes, shared.class)
+			}
+		}
+	}
+	for hn, f := range files {
+		if out[hn+".mcl"], err = f.render(fmt.Sprintf("Generated MCL for host %q", hn)); err != nil {
+			return nil, fmt.Errorf("render host %q: %w", hn, err)
+		}
+	}
+	if opts.Dispatch {
+		if out[DispatchFile], err = renderDispatch(doc, aliases); err != nil {
+			return nil, fmt.Errorf("render %s: %w", DispatchFile, err)
+		}
+	}
+	return out, nil
+}
+
+// RenderDocumentHost renders only the host hn of a multi-host document, for
+// a deploy of its own. Its collect declarations are resolved against the
+// exports of the other hosts, and the document is rejected if CheckExchange
+// finds a problem.
+func RenderDocumentHost(doc ir.Document, hn string, opts RenderOptions) ([]byte, error) {
+	h, ok := doc[hn]
+	if !ok {
+		return nil, fmt.Errorf("host %q is not in the document", hn)
+	}
+	if err := CheckExchange(doc); err != nil {
+		return nil, err
+	}
+	return renderHost(hn, exportsByHostname(doc, h), documentSources(doc), opts)
+}
+
+// hostAliases maps each host to the identifier its file is imported as, and
+// rejects hosts that sys.hostname() can't tell apart.
+func hostAliases(doc ir.Document) (map[string]string, error) {
+	aliases := make(map[string]string, len(doc))
+	seen := make(map[string]string, len(doc))
+	hostnames := make(map[string]string, len(doc))
+	for _, hn := range sortedKeysMap(doc) {
+		if hn+".mcl" == DispatchFile {
+			return nil, fmt.Errorf("host %q: name collides with the dispatch entry point %s", hn, DispatchFile)
+		}
+		name := hostname(doc, hn)
+		if other, ok := hostnames[name]; ok {
+			return nil, fmt.Errorf("hosts %q and %q have the same hostname %q", other, hn, name)
+		}
+		hostnames[name] = hn
+		alias := "host_" + mclIdent(hn)
+		if other, ok := seen[alias]; ok {
+			return nil, fmt.Errorf("hosts %q and %q map to the same import name %s", other, hn, alias)
+		}
+		seen[alias] = hn
+		aliases[hn] = alias
+	}
+	return aliases, nil
+}
+
+// renderDispatch renders a main.mcl that imports every host file and includes
+// the class of the host whose sys.hostname() matches.
+func renderDispatch(doc ir.Document, aliases map[string]string) ([]byte, error) {
+	hosts := sortedKeysMap(doc)
+	var buf bytes.Buffer
+	fmt.Fprintf(&buf, "# Generated MCL dispatching on sys.hostname() for hosts %q\n\n", hosts)
+	fmt.Fprintf(&buf, "import %q\n", "sys")
+	for _, hn := range hosts {
+		path, err := quoteString(hn + ".mcl")
+		if err != nil {
+			return nil, err
+		}
+		fmt.Fprintf(&buf, "import %s as %s\n", path, aliases[hn])
+	}
+	fmt.Fprintln(&buf)
+	fmt.Fprintln(&buf, "$hostname = sys.hostname()")
+	fmt.Fprintln(&buf)
+	for _, hn := range hosts {
+		lit, err := quoteString(hostname(doc, hn))
+		if err != nil {
+			return nil, fmt.Errorf("host %q: hostname: %w", hn, err)
+		}
+		fmt.Fprintf(&buf, "if $hostname == %s {\n", lit)
+		fmt.Fprintf(&buf, "  include %s.host\n", aliases[hn])
+		fmt.Fprint(&buf, "}\n")
+	}
+	return buf.Bytes(), nil
+}
+
+// mclIdent turns s into a lowercase MCL identifier.
+func mclIdent(s string) string {
+	var b strings.Builder
+	for _, r := range strings.ToLower(s) {
+		if (r >= 'a' && r <= 'z') || (r >= '0' && r <= '9') {
+			b.WriteRune(r)
+		} else {
+			b.WriteByte('_')
+		}
+	}
+	return b.String()
+}
@@ -0,0 +1,184 @@
+package mclgen
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"fmt"
+	"github.com/karpfediem/rx.nix/codegen/internal/ir"
+	"os"
+	"strings"
+)
+
+// Encrypted secrets ship with the deploy: the ciphertext is copied into
+// files/secrets/ and decrypted on the host with the host's key, e.g.
+// {"__secret": {"provider": "age", "file": "/nix/store/...-db.age"}} or
+// {"__secret": {"provider": "sops", "ciphertext": "..."}}. mgmt doesn't
+// decrypt them: function values such as os.readfile are evaluated before any
+// resource runs, and edges only order resources, so rx.mgmt decrypts every
+// payload of a deploy into SecretRunDir before mgmt gets to see it (see
+// pkgs/decrypt-secrets.nix), and the MCL only reads the result.
+
+// encryptedProviders are the providers of secrets shipped encrypted. The
+// payload of each is stored with the provider as its file extension, which
+// tells the host how to decrypt it.
+var encryptedProviders = map[string]bool{"age": true, "sops": true}
+
+// SecretRunDir is where hosts keep decrypted secrets, outside the deploy.
+const SecretRunDir = "/run/rx/secrets"
+
+// decrypt is an encrypted secret resolved for a host: the file at path that
+// the host decrypts it into. Going through a file keeps multi-line secrets
+// whole, which the output of os.system, read line by line, does not.
+type decrypt struct{ path string }
+
+func encryptedRef(v any) (map[string]any, bool) {
+	ref, ok := secretRef(v)
+	if !ok {
+		return nil, false
+	}
+	provider, _ := ref["provider"].(string)
+	return ref, encryptedProviders[provider]
+}
+
+// payloadPath returns where an encrypted payload is stored in the deploy. The
+// name is derived from the reference, so every host sharing a secret ships
+// the same file.
+func payloadPath(ref map[string]any) (string, error) {
+	provider, _ := ref["provider"].(string)
+	file, _ := ref["file"].(string)
+	ciphertext, _ := ref["ciphertext"].(string)
+	if (file == "") == (ciphertext == "") {
+		return "", fmt.Errorf("%s: provider %s needs exactly one of file or ciphertext", secretTag, provider)
+	}
+	sum := sha256.Sum256([]byte(provider + "\x00" + file + "\x00" + ciphertext))
+	return "files/secrets/" + hex.EncodeToString(sum[:8]) + "." + provider, nil
+}
+
+// resolveEncrypted replaces the encrypted secrets within h's values by
+// the commands decrypting them on the host.
+func resolveEncrypted(h ir.Host) (ir.Host, error) {
+	var walk func(v any) (any, error)
+	walk = func(v any) (any, error) {
+		if ref, ok := encryptedRef(v); ok {
+			if h.SecretKey == "" {
+				return nil, fmt.Errorf("%s: provider %v needs the host's secretKey (rx.mgmt.secretKeyFile)", secretTag, ref["provider"])
+			}
+			path, err := payloadPath(ref)
+			if err != nil {
+				return nil, err
+			}
+			return decrypt{path: SecretRunDir + "/" + strings.TrimPrefix(path, "files/secrets/")}, nil
+		}
+		switch x := v.(type) {
+		case []any:
+			out := make([]any, len(x))
+			for i, el := range x {
+				var err error
+				if out[i], err = walk(el); err != nil {
+					return nil, err
+				}
+			}
+			return out, nil
+		case map[string]any:
+			out := make(map[string]any, len(x))
+			for k, el := range x {
+				var err error
+				if out[k], err = walk(el); err != nil {
+					return nil, err
+				}
+			}
+			return out, nil
+		}
+		return v, nil
+	}
+	walkMap := func(m map[string]any) (map[string]any, error) {
+		if m == nil {
+			return nil, nil
+		}
+		out, err := walk(m)
+		if err != nil {
+			return nil, err
+		}
+		return out.(map[string]any), nil
+	}
+
+	var err error
+	if h.Vars, err = walkMap(h.Vars); err != nil {
+		return h, fmt.Errorf("vars: %w", err)
+	}
+	res := make(map[string]map[string]map[string]any, len(h.Res))
+	for kind, insts := range h.Res {
+		res[kind] = make(map[string]map[string]any, len(insts))
+		for name, params := range insts {
+			if res[kind][name], err = walkMap(params); err != nil {
+				return h, fmt.Errorf("%s %q: %w", kind, name, err)
+			}
+		}
+	}
+	h.Res = res
+	collect := make([]ir.Collect, len(h.Collect))
+	for i, c := range h.Collect {
+		if c.Params, err = walkMap(c.Params); err != nil {
+			return h, fmt.Errorf("%s: %w", describeCollect(c), err)
+		}
+		collect[i] = c
+	}
+	h.Collect = collect
+	return h, nil
+}
+
+// SecretPayloads returns the encrypted payloads h references, keyed by their
+// path in the deploy. Payloads given as a file are read from disk.
+func SecretPayloads(h ir.Host) (map[string][]byte, error) {
+	out := make(map[string][]byte)
+	var walk func(v any) error
+	walk = func(v any) error {
+		if ref, ok := encryptedRef(v); ok {
+			path, err := payloadPath(ref)
+			if err != nil {
+				return err
+			}
+			if file, _ := ref["file"].(string); file != "" {
+				data, err := os.ReadFile(file)
+				if err != nil {
+					return fmt.Errorf("%s: %w", secretTag, err)
+				}
+				out[path] = data
+			} else {
+				out[path] = []byte(ref["ciphertext"].(string))
+			}
+			return nil
+		}
+		switch x := v.(type) {
+		case []any:
+			for _, el := range x {
+				if err := walk(el); err != nil {
+					return err
+				}
+			}
+		case map[string]any:
+			for _, el := range x {
+				if err := walk(el); err != nil {
+					return err
+				}
+			}
+		}
+		return nil
+	}
+	if err := walk(h.Vars); err != nil {
+		return nil, err
+	}
+	for _, insts := range h.Res {
+		for _, params := range insts {
+			if err := walk(params); err != nil {
+				return nil, err
+			}
+		}
+	}
+	for _, c := range h.Collect {
+		if err := walk(c.Params); err != nil {
+			return nil, err
+		}
+	}
+	return out, nil
+}
@@ -0,0 +1,163 @@
+package mclgen
+
+import (
+	"errors"
+	"fmt"
+	"github.com/karpfediem/rx.nix/codegen/internal/ir"
+	"slices"
+	"sort"
+	"strings"
+)
+
+// collectSource is one exported resource picked up by a collect declaration.
+type collectSource struct {
+	name string
+	host string
+}
+
+// sourceFunc resolves the exported resources a host's collect refers to.
+type sourceFunc func(host string, c ir.Collect) ([]collectSource, error)
+
+// CheckExchange validates exports and collects across the hosts of doc: every
+// exported resource must be defined by its host and exported to hosts of doc,
+// and every collect must match at least one resource exported to the
+// collecting host.
+func CheckExchange(doc ir.Document) error {
+	var errs []error
+	resolve := documentSources(doc)
+	for _, hn := range sortedKeysMap(doc) {
+		h := doc[hn]
+		for _, kind := range sortedKeysMap(h.Export) {
+			for _, name := range sortedKeysMap(h.Export[kind]) {
+				if _, ok := h.Res[kind][name]; !ok {
+					errs = append(errs, fmt.Errorf("host %q: exports undefined resource %s %q", hn, kind, name))
+				}
+				for _, to := range sortedHosts(h.Export[kind][name]) {
+					if _, ok := doc[to.(string)]; !ok && to != "*" {
+						errs = append(errs, fmt.Errorf("host %q: exports %s %q to unknown host %q", hn, kind, name, to))
+					}
+				}
+			}
+		}
+		for _, c := range h.Collect {
+			if _, err := resolve(hn, c); err != nil {
+				errs = append(errs, err)
+			}
+		}
+	}
+	return errors.Join(errs...)
+}
+
+// staticSources resolves a collect without knowledge of the other hosts, so
+// both the resource name and the exporting hosts must be spelled out.
+func staticSources(host string, c ir.Collect) ([]collectSource, error) {
+	if c.Name == "" || len(c.From) == 0 {
+		return nil, fmt.Errorf("host %q: %s needs both name and from outside a multi-host document", host, describeCollect(c))
+	}
+	var out []collectSource
+	for _, from := range sortedHosts(c.From) {
+		out = append(out, collectSource{name: c.Name, host: from.(string)})
+	}
+	return out, nil
+}
+
+func documentSources(doc ir.Document) sourceFunc {
+	return func(host string, c ir.Collect) ([]collectSource, error) {
+		var out []collectSource
+		for _, from := range sortedKeysMap(doc) {
+			if from == host || (len(c.From) > 0 && !slices.Contains(c.From, from)) {
+				continue
+			}
+			byName := doc[from].Export[c.Kind]
+			for _, name := range sortedKeysMap(byName) {
+				if c.Name != "" && name != c.Name {
+					continue
+				}
+				if slices.Contains(byName[name], host) || slices.Contains(byName[name], "*") {
+					out = append(out, collectSource{name: name, host: hostname(doc, from)})
+				}
+			}
+		}
+		if len(out) == 0 {
+			return nil, fmt.Errorf("host %q: %s has no exporter", host, describeCollect(c))
+		}
+		return out, nil
+	}
+}
+
+// hostname returns the name mgmt knows host hn of doc by, which exports and
+// collects must use: its Hostname, defaulting to hn.
+func hostname(doc ir.Document, hn string) string {
+	if name := doc[hn].Hostname; name != "" {
+		return name
+	}
+	return hn
+}
+
+// exportsByHostname returns h with the hosts it exports to named by their
+// hostname in doc.
+func exportsByHostname(doc ir.Document, h ir.Host) ir.Host {
+	if len(h.Export) == 0 {
+		return h
+	}
+	export := make(map[string]map[string][]string, len(h.Export))
+	for kind, byName := range h.Export {
+		export[kind] = make(map[string][]string, len(byName))
+		for name, hosts := range byName {
+			to := make([]string, len(hosts))
+			for i, hn := range hosts {
+				to[i] = hn
+				if hn != "*" {
+					to[i] = hostname(doc, hn)
+				}
+			}
+			export[kind][name] = to
+		}
+	}
+	h.Export = export
+	return h
+}
+
+func renderCollect(b *strings.Builder, opts RenderOptions, c ir.Collect, srcs []collectSource) error {
+	fmt.Fprintf(b, "collect %s [\n", c.Kind)
+	for _, s := range srcs {
+		name, err := quoteString(s.name)
+		if err != nil {
+			return err
+		}
+		host, err := quoteString(s.host)
+		if err != nil {
+			return err
+		}
+		fmt.Fprintf(b, "  struct{name => %s, host => %s,},\n", name, host)
+	}
+	fmt.Fprint(b, "] {\n")
+	if err := renderParams(b, opts, c.Kind, c.Params); err != nil {
+		return err
+	}
+	fmt.Fprint(b, "}\n\n")
+	return nil
+}
+
+func describeCollect(c ir.Collect) string {
+	s := "collect " + c.Kind
+	if c.Name != "" {
+		s += fmt.Sprintf(" %q", c.Name)
+	}
+	if len(c.From) > 0 {
+		s += fmt.Sprintf(" from %v", sortedHosts(c.From))
+	}
+	return s
+}
+
+// sortedHosts returns a sorted, de-duplicated copy of hosts as IR list values.
+func sortedHosts(hosts []string) []any {
+	hs := append([]string(nil), hosts...)
+	sort.Strings(hs)
+	hs = slices.Compact(hs)
+	out := make([]any, len(hs))
+	for i, h := range hs {
+		out[i] = h
+	}
+	return out
+}
@@ -0,0 +1,284 @@
+package mclgen
+
+import (
+	"encoding/json"
+	"fmt"
+	"github.com/karpfediem/rx.nix/codegen/internal/ir"
+	"github.com/karpfediem/rx.nix/codegen/internal/mclparse"
+	"github.com/karpfediem/rx.nix/codegen/internal/testutil"
+	"math"
+	"reflect"
+	"regexp"
+	"strconv"
+	"strings"
+	"testing"
+	"unicode/utf8"
+)
+
+// mgmtStringLit and mgmtEscapes are the string rules of mgmt's lexer
+// (lang/parser/lexer.nex, at the rev pinned in pkgs/nixos-options.nix,
+// 8293d37f4500dfe4d530e4aa7dbe4ab8be352dc1): a string is "(\\.|[^"])*" and
+// these are its escapes; a $ only starts an interpolation before {. They are
+// kept apart from mclparse's lexer so that the encoder is not checked
+// against the parser it was written with.
+var (
+	mgmtStringLit = regexp.MustCompile(`"(\\.|[^"\\])*"`)
+	mgmtEscapes   = map[byte]byte{'\\': '\\', '"': '"', 'n': '\n', 't': '\t', 'r': '\r', '$': '$'}
+)
+
+// mgmtUnquote decodes the string literal lit by mgmt's rules, failing on
+// anything the rules don't allow, including interpolations.
+func mgmtUnquote(lit string) (string, error) {
+	if m := mgmtStringLit.FindString(lit); m != lit {
+		return "", fmt.Errorf("%s is not a single string literal", lit)
+	}
+	var b strings.Builder
+	body := lit[1 : len(lit)-1]
+	for i := 0; i < len(body); i++ {
+		switch c := body[i]; {
+		case c == '\\':
+			e, ok := mgmtEscapes[body[i+1]]
+			if !ok {
+				return "", fmt.Errorf("%s: unknown escape \\%c", lit, body[i+1])
+			}
+			b.WriteByte(e)
+			i++
+		case c == '$' && i+1 < len(body) && body[i+1] == '{':
+			return "", fmt.Errorf("%s: unescaped interpolation", lit)
+		default:
+			b.WriteByte(c)
+		}
+	}
+	return b.String(), nil
+}
+
+// checkStrings checks every string literal of the rendered src against
+// mgmt's rules.
+func checkStrings(t *testing.T, src string) {
+	t.Helper()
+	for _, lit := range mgmtStringLit.FindAllString(src, -1) {
+		if _, err := mgmtUnquote(lit); err != nil {
+			t.Fatal(err)
+		}
+	}
+}
+
+// TestQuoteString pins the literals quoteString writes, worked out by hand
+// from mgmt's rules above.
+func TestQuoteString(t *testing.T) {
+	for _, tc := range []struct{ s, lit string }{
+		{"", `""`},
+		{"plain", `"plain"`},
+		{`a"b`, `"a\"b"`},
+		{`C:\dir`, `"C:\\dir"`},
+		{"line1\nline2\n", `"line1\nline2\n"`},
+		{"a\tb\r\n", `"a\tb\r\n"`},
+		{"${x}", `"\${x}"`},
+		{"$x and $", `"$x and $"`},
+		{"$${x}", `"$\${x}"`},
+		{"{}", `"{}"`},
+		{"grüße ✓", `"grüße ✓"`},
+		{"\\${x}", `"\\\${x}"`},
+	} {
+		lit, err := quoteString(tc.s)
+		if err != nil {
+			t.Errorf("quoteString(%q): %v", tc.s, err)
+			continue
+		}
+		if lit != tc.lit {
+			t.Errorf("quoteString(%q) = %s, want %s", tc.s, lit, tc.lit)
+		}
+		if got, err := mgmtUnquote(lit); err != nil || got != tc.s {
+			t.Errorf("%s decodes by mgmt's rules to %q, %v; want %q", lit, got, err, tc.s)
+		}
+	}
+	for _, s := range []string{"a\x00b", "\xff", "\xc3"} {
+		if lit, err := quoteString(s); err == nil {
+			t.Errorf("quoteString(%q) = %s, want an error", s, lit)
+		}
+	}
+}
+
+// decodeMCL parses a rendered MCL value back into IR form, after checking its
+// strings against mgmt's rules.
+func decodeMCL(t *testing.T, src string) any {
+	t.Helper()
+	checkStrings(t, src)
+	e, err := mclparse.ParseExpr(src)
+	if err != nil {
+		t.Fatalf("parse %s: %v", src, err)
+	}
+	v, err := mclparse.Value(e)
+	if err != nil {
+		t.Fatalf("decode %s: %v", src, err)
+	}
+	return v
+}
+
+// representable reports whether s can be written as an MCL string.
+func representable(s string) bool {
+	return utf8.ValidString(s) && strings.IndexByte(s, 0) < 0
+}
+
+func FuzzRenderString(f *testing.F) {
+	for _, s := range testutil.NastyStrings {
+		f.Add(s)
+	}
+	f.Fuzz(func(t *testing.T, s string) {
+		src, err := renderValue(s, nil, 0)
+		if !representable(s) {
+			if err == nil {
+				t.Fatalf("renderValue(%q) = %s, want an error", s, src)
+			}
+			return
+		}
+		if err != nil {
+			t.Fatalf("renderValue(%q): %v", s, err)
+		}
+		if got, err := mgmtUnquote(src); err != nil || got != s {
+			t.Fatalf("renderValue(%q) = %s decodes by mgmt's rules to %q, %v", s, src, got, err)
+		}
+		if got := decodeMCL(t, src); got != s {
+			t.Fatalf("renderValue(%q) = %s decodes to %q", s, src, got)
+		}
+	})
+}
+
+func FuzzRenderList(f *testing.F) {
+	for i, s := range testutil.NastyStrings {
+		f.Add(s, int64(i)-3, i%2 == 0)
+	}
+	f.Fuzz(func(t *testing.T, s string, n int64, b bool) {
+		if !representable(s) {
+			t.Skip()
+		}
+		v := []any{s, n, b, []any{}, []any{s}}
+		src, err := renderValue(v, nil, 0)
+		if err != nil {
+			t.Fatalf("renderValue(%#v): %v", v, err)
+		}
+		if got := decodeMCL(t, src); !reflect.DeepEqual(got, v) {
+			t.Fatalf("renderValue(%#v) = %s decodes to %#v", v, src, got)
+		}
+	})
+}
+
+func FuzzRenderMap(f *testing.F) {
+	for _, s := range testutil.NastyStrings {
+		f.Add(s, s)
+	}
+	f.Fuzz(func(t *testing.T, k, s string) {
+		if !representable(k) || !representable(s) {
+			t.Skip()
+		}
+		m := map[string]any{k: s, "list": []any{s}}
+		for _, v := range []any{m, map[string]any{mapTag: m}} {
+			src, err := renderValue(v, nil, 0)
+			if err != nil {
+				t.Fatalf("renderValue(%#v): %v", v, err)
+			}
+			if got := decodeMCL(t, src); !reflect.DeepEqual(got, m) {
+				t.Fatalf("renderValue(%#v) = %s decodes to %#v", v, src, got)
+			}
+		}
+	})
+}
+
+func FuzzRenderNumber(f *testing.F) {
+	f.Add(int64(0), 0.0)
+	f.Add(int64(-1), 1.0)
+	f.Add(int64(math.MaxInt64), -0.5)
+	f.Add(int64(math.MinInt64), 1e300)
+	f.Add(int64(9007199254740993), 5e-324)
+	f.Fuzz(func(t *testing.T, n int64, x float64) {
+		if math.IsInf(x, 0) || math.IsNaN(x) {
+			t.Skip()
+		}
+		float := &valueType{kind: floatValue}
+		for _, tc := range []struct {
+			v    any
+			t    *valueType
+			want any
+		}{
+			{json.Number(strconv.FormatInt(n, 10)), nil, n},
+			{n, nil, n},
+			{json.Number(strconv.FormatFloat(x, 'g', -1, 64)), float, x},
+			{x, nil, x},
+		} {
+			src, err := renderValue(tc.v, tc.t, 0)
+			if err != nil {
+				t.Fatalf("renderValue(%v): %v", tc.v, err)
+			}
+			if got := decodeMCL(t, src); got != tc.want {
+				t.Fatalf("renderValue(%v) = %s decodes to %v (%T)", tc.v, src, got, got)
+			}
+		}
+	})
+}
+
+// FuzzRenderHost checks strings in their place in a host file, where a
+// multi-line literal must survive the surrounding layout.
+func FuzzRenderHost(f *testing.F) {
+	for _, s := range testutil.NastyStrings {
+		f.Add(s)
+	}
+	f.Fuzz(func(t *testing.T, s string) {
+		if !representable(s) {
+			t.Skip()
+		}
+		h := ir.Host{
+			Imports: []string{s},
+			Res:     map[string]map[string]map[string]any{"file": {s: {"content": s}}},
+		}
+		out, err := RenderHost("fuzz", h, RenderOptions{})
+		if err != nil {
+			t.Fatalf("RenderHost(%q): %v", s, err)
+		}
+		checkStrings(t, string(out))
+		file, err := mclparse.Parse(string(out))
+		if err != nil {
+			t.Fatalf("RenderHost(%q) does not parse: %v\n%s", s, err, out)
+		}
+		var got []any
+		for _, st := range file.Stmts {
+			switch st := st.(type) {
+			case *mclparse.Import:
+				got = append(got, st.Path)
+			case *mclparse.Resource:
+				name, err := mclparse.Value(st.Name)
+				if err != nil {
+					t.Fatal(err)
+				}
+				content, err := mclparse.Value(st.Fields[0].Value)
+				if err != nil {
+					t.Fatal(err)
+				}
+				got = append(got, name, content)
+			}
+		}
+		if want := []any{s, s, s}; !reflect.DeepEqual(got, want) {
+			t.Fatalf("RenderHost(%q) reads back as %q:\n%s", s, got, out)
+		}
+	})
+}
+
+var identRE = regexp.MustCompile(`^[a-z]([a-z0-9_]*[a-z0-9])?$`)
+
+func FuzzIsIdent(f *testing.F) {
+	for _, s := range append(testutil.NastyStrings, "a", "a_b", "a_", "_a", "a1", "1a", "A", "a-b", "a.b", "a:b", "a/b", "a$", "if", "struct") {
+		f.Add(s)
+	}
+	f.Fuzz(func(t *testing.T, s string) {
+		ok := isIdent(s)
+		if want := identRE.MatchString(s) && !mclKeywords[s]; ok != want {
+			t.Fatalf("isIdent(%q) = %v, want %v", s, ok, want)
+		}
+		if !ok {
+			return
+		}
+		src := "struct{" + s + " => 1}"
+		if got := decodeMCL(t, src); !reflect.DeepEqual(got, map[string]any{s: int64(1)}) {
+			t.Fatalf("%s decodes to %#v", src, got)
+		}
+	})
+}
@@ -0,0 +1,248 @@
+package mclgen
+
+import (
+	"encoding/json"
+	"fmt"
+	"math"
+	"sort"
+	"strconv"
+	"strings"
+	"unicode/utf8"
+)
+
+// The encoders below follow mgmt's lexer (lang/parser/lexer.nex) and string
+// interpolation (lang/interpolate): a string literal is double-quoted, may
+// span lines and knows the escapes \\ \" \n \t \r and \$; identifiers are
+// lowercase letters, digits and inner underscores.
+
+// IR markers that pin an attribute set to an MCL map or struct literal where
+// no param type is known, e.g. {"__map": {"k": "v"}}.
+const (
+	mapTag    = "__map"
+	structTag = "__struct"
+)
+
+// renderValue renders an IR value as an MCL expression of type t (nil if
+// unknown). Maps and structs are laid out one entry per line, indented for
+// nesting level indentLevel.
+func renderValue(v any, t *valueType, indentLevel int) (string, error) {
+	switch x := v.(type) {
+	case nil:
+		return "null", nil
+	case string:
+		return quoteString(x)
+	case bool:
+		return strconv.FormatBool(x), nil
+	case json.Number:
+		return renderNumber(x.String(), strings.ContainsAny(x.String(), ".eE"), t)
+	case float64:
+		return renderNumber(strconv.FormatFloat(x, 'g', -1, 64), true, t)
+	case float32:
+		return renderNumber(strconv.FormatFloat(float64(x), 'g', -1, 32), true, t)
+	case int, int8, int16, int32, int64, uint, uint8, uint16, uint32, uint64:
+		return renderNumber(fmt.Sprintf("%d", x), false, t)
+	case []any:
+		if len(x) == 0 {
+			return "[]", nil
+		}
+		var b strings.Builder
+		b.WriteString("[")
+		for i, el := range x {
+			if i > 0 {
+				b.WriteString(", ")
+			}
+			lit, err := renderValue(el, t.elemType(), indentLevel+1)
+			if err != nil {
+				return "", fmt.Errorf("list element %d: %w", i, err)
+			}
+			b.WriteString(lit)
+		}
+		b.WriteString("]")
+		return b.String(), nil
+	case map[string]any:
+		if ref, ok := secretRef(x); ok {
+			return renderSecret(ref)
+		}
+		if c, ok := callRef(x); ok {
+			return renderCall(c, indentLevel)
+		}
+		if c, ok := constRef(x); ok {
+			return renderConst(c)
+		}
+		m, isMap, err := mapKind(x, t)
+		if err != nil {
+			return "", err
+		}
+		if isMap {
+			return renderEntries(m, "{", t.elemType(), indentLevel, quoteString)
+		}
+		return renderEntries(m, "struct{", nil, indentLevel, func(k string) (string, error) {
+			if !isIdent(k) {
+				return "", fmt.Errorf("struct field %q is not a valid MCL identifier", k)
+			}
+			return k, nil
+		})
+	case decrypt:
+		path, err := quoteString(x.path)
+		if err != nil {
+			return "", err
+		}
+		return "os.readfile(" + path + ")", nil
+	default:
+		return "", fmt.Errorf("unsupported value of type %T", v)
+	}
+}
+
+// renderNumber renders the decimal text of a number as an MCL int or float.
+// An int or float param type decides; otherwise isFloat does, which is true
+// for Go floats and for JSON numbers with a fraction or exponent. Ints must
+// be whole and fit in int64, as in mgmt.
+func renderNumber(text string, isFloat bool, t *valueType) (string, error) {
+	if t != nil && (t.kind == intValue || t.kind == floatValue) {
+		isFloat = t.kind == floatValue
+	}
+	if isFloat {
+		f, err := strconv.ParseFloat(text, 64)
+		if err != nil || math.IsInf(f, 0) || math.IsNaN(f) {
+			return "", fmt.Errorf("%s cannot be represented as an MCL float", text)
+		}
+		s := strconv.FormatFloat(f, 'f', -1, 64)
+		if !strings.Contains(s, ".") {
+			s += ".0"
+		}
+		return s, nil
+	}
+	if n, err := strconv.ParseInt(text, 10, 64); err == nil {
+		return strconv.FormatInt(n, 10), nil
+	}
+	// A float param type may be missing, but a whole float for an int
+	// param (e.g. 2.0 or 1e3) is still exact.
+	f, err := strconv.ParseFloat(text, 64)
+	if err == nil && f == math.Trunc(f) && f >= math.MinInt64 && f < math.MaxInt64 {
+		return strconv.FormatInt(int64(f), 10), nil
+	}
+	return "", fmt.Errorf("%s is not an integer in MCL's int64 range", text)
+}
+
+// mapKind decides whether m is written as an MCL map or struct literal. An
+// explicit __map or __struct tag wins, then the Go type of the param.
+// Otherwise m is a struct if it has keys and all of them are identifiers,
+// and a map if not.
+func mapKind(m map[string]any, t *valueType) (map[string]any, bool, error) {
+	if len(m) == 1 {
+		for tag, inner := range m {
+			if tag != mapTag && tag != structTag {
+				break
+			}
+			im, ok := inner.(map[string]any)
+			if !ok {
+				return nil, false, fmt.Errorf("%s must hold an attribute set, not %T", tag, inner)
+			}
+			return im, tag == mapTag, nil
+		}
+	}
+	if t != nil && (t.kind == mapValue || t.kind == structValue) {
+		return m, t.kind == mapValue, nil
+	}
+	if len(m) == 0 {
+		return m, true, nil
+	}
+	for k := range m {
+		if !isIdent(k) {
+			return m, true, nil
+		}
+	}
+	return m, false, nil
+}
+
+// renderEntries renders the sorted entries of a map or struct literal that
+// starts with open; key renders each key.
+func renderEntries(m map[string]any, open string, elem *valueType, indentLevel int, key func(string) (string, error)) (string, error) {
+	if len(m) == 0 {
+		return open + "}", nil
+	}
+	keys := make([]string, 0, len(m))
+	for k := range m {
+		keys = append(keys, k)
+	}
+	sort.Strings(keys)
+	indent := strings.Repeat("  ", indentLevel)
+	inner := strings.Repeat("  ", indentLevel+1)
+	var b strings.Builder
+	b.WriteString(open + "\n")
+	for _, k := range keys {
+		kl, err := key(k)
+		if err != nil {
+			return "", err
+		}
+		lit, err := renderValue(m[k], elem, indentLevel+1)
+		if err != nil {
+			return "", fmt.Errorf("key %q: %w", k, err)
+		}
+		fmt.Fprintf(&b, "%s%s => %s,\n", inner, kl, lit)
+	}
+	b.WriteString(indent)
+	b.WriteString("}")
+	return b.String(), nil
+}
+
+// quoteString renders s as an MCL string literal. Newlines are written as \n
+// so a literal can be re-indented, and a $ that would start an interpolation
+// is escaped. Other control characters are copied verbatim. NUL bytes and
+// invalid UTF-8 cannot be read back by mgmt and are an error.
+func quoteString(s string) (string, error) {
+	if i := strings.IndexByte(s, 0); i >= 0 {
+		return "", fmt.Errorf("string %q: NUL byte at offset %d cannot be represented in MCL", s, i)
+	}
+	if !utf8.ValidString(s) {
+		return "", fmt.Errorf("string %q: invalid UTF-8 cannot be represented in MCL", s)
+	}
+	var b strings.Builder
+	b.Grow(len(s) + 2)
+	b.WriteByte('"')
+	for i := 0; i < len(s); i++ {
+		switch c := s[i]; c {
+		case '"', '\\':
+			b.WriteByte('\\')
+			b.WriteByte(c)
+		case '\n':
+			b.WriteString(`\n`)
+		case '\r':
+			b.WriteString(`\r`)
+		case '\t':
+			b.WriteString(`\t`)
+		case '$':
+			if i+1 < len(s) && s[i+1] == '{' {
+				b.WriteByte('\\')
+			}
+			b.WriteByte(c)
+		default:
+			b.WriteByte(c)
+		}
+	}
+	b.WriteByte('"')
+	return b.String(), nil
+}
+
+var mclKeywords = map[string]bool{
+	"and": true, "as": true, "class": true, "collect": true, "else": true,
+	"false": true, "for": true, "forkv": true, "func": true, "if": true,
+	"import": true, "in": true, "include": true, "not": true, "or": true,
+	"struct": true, "true": true, "variant": true,
+}
+
+// isIdent reports whether s can be written as a bare MCL identifier:
+// [a-z]([a-z0-9_]*[a-z0-9])? and not a keyword.
+func isIdent(s string) bool {
+	if s == "" || mclKeywords[s] || s[len(s)-1] == '_' {
+		return false
+	}
+	for i := 0; i < len(s); i++ {
+		c := s[i]
+		ok := c >= 'a' && c <= 'z' || i > 0 && (c == '_' || c >= '0' && c <= '9')
+		if !ok {
+			return false
+		}
+	}
+	return true
+}
@@ -2,41 +2,81 @@ package mclgen
 
 import (
 	"bytes"
-	"encoding/json"
 	"fmt"
 	"github.com/karpfediem/rx.nix/codegen/internal/ir"
 	"sort"
-	"strconv"
 	"strings"
 )
 
-func RenderHost(name string, h ir.Host) ([]byte, error) {
-	var buf bytes.Buffer
-	fmt.Fprintf(&buf, "# Generated MCL for host %q\n\n", name)
+// RenderHost renders a single host in isolation. Collect declarations must
+// name both the resource and the exporting hosts, since there is no document
+// to resolve exporters from; use RenderDocument for multi-host IR.
+func RenderHost(name string, h ir.Host, opts RenderOptions) ([]byte, error) {
+	return renderHost(name, h, staticSources, opts)
+}
 
-	// imports
-	if len(h.Imports) > 0 {
-		imp := append([]string(nil), h.Imports...)
-		sort.Strings(imp)
-		for _, s := range imp {
-			fmt.Fprintf(&buf, "import %q\n", s)
-		}
-		fmt.Fprintln(&buf)
+// RenderOptions controls how values are rendered.
+type RenderOptions struct {
+	// Schema, if set, types resource params, e.g. from the manifest written
+	// by cmd/nixos.
+	Schema Schema
+	// AllowLiteralSecrets renders params that look sensitive even when they
+	// hold a literal instead of a __secret reference.
+	AllowLiteralSecrets bool
+}
+
+func renderHost(name string, h ir.Host, sources sourceFunc, opts RenderOptions) ([]byte, error) {
+	f, err := hostFile(name, h, sources, opts)
+	if err != nil {
+		return nil, err
+	}
+	return f.render(fmt.Sprintf("Generated MCL for host %q", name))
+}
+
+// mclFile is a host's MCL split into individually keyed statements, so that
+// statements common to several hosts can be moved into a shared module.
+type mclFile struct {
+	imports []string
+	modules []string // files imported with `as *`
+	vars    []stmt
+	raw     []stmt
+	res     []stmt
+	collect []stmt
+
+	// class, if set, wraps raw, resource and collect statements in a class
+	// of that name (vars stay top-level and are captured by the class), and
+	// includes lists the classes included from its body.
+	class    string
+	includes []string
+}
+
+// stmt is one rendered top-level statement; key identifies what it defines.
+type stmt struct {
+	key  string
+	text string
+}
+
+func hostFile(name string, h ir.Host, sources sourceFunc, opts RenderOptions) (*mclFile, error) {
+	h, err := resolveEncrypted(h)
+	if err != nil {
+		return nil, err
 	}
+	f := &mclFile{imports: append([]string(nil), h.Imports...)}
+	sort.Strings(f.imports)
 
 	// vars (strings treated as expressions)
-	if len(h.Vars) > 0 {
-		keys := sortedKeysAny(h.Vars)
-		for _, k := range keys {
-			v := h.Vars[k]
-			switch vv := v.(type) {
-			case string:
-				fmt.Fprintf(&buf, "$%s = %s\n", k, strings.TrimSpace(vv))
-			default:
-				fmt.Fprintf(&buf, "$%s = %s\n", k, renderValue(v, 0, true))
+	for _, k := range sortedKeysAny(h.Vars) {
+		v := h.Vars[k]
+		switch vv := v.(type) {
+		case string:
+			f.vars = append(f.vars, stmt{key: k, text: fmt.Sprintf("$%s = %s\n", k, strings.TrimSpace(vv))})
+		default:
+			lit, err := renderValue(v, nil, 0)
+			if err != nil {
+				return nil, fmt.Errorf("var $%s: %w", k, err)
 			}
+			f.vars = append(f.vars, stmt{key: k, text: fmt.Sprintf("$%s = %s\n", k, lit)})
 		}
-		fmt.Fprintln(&buf)
 	}
 
 	// raw
@@ -44,161 +84,244 @@ func RenderHost(name string, h ir.Host) ([]byte, error) {
 		if !strings.HasSuffix(s, "\n") {
 			s += "\n"
 		}
-		fmt.Fprint(&buf, s)
 		if !strings.HasSuffix(s, "\n\n") {
-			fmt.Fprintln(&buf)
+			s += "\n"
 		}
+		f.raw = append(f.raw, stmt{key: s, text: s})
 	}
 
 	// resources
-	if len(h.Res) > 0 {
-		rKinds := sortedKeysMap(h.Res)
-		for _, kind := range rKinds {
-			insts := h.Res[kind]
-			if len(insts) == 0 {
+	for _, kind := range sortedKeysMap(h.Res) {
+		insts := h.Res[kind]
+		for _, inst := range sortedKeysMap(insts) {
+			fields := insts[inst]
+			nonNull := make(map[string]any, len(fields))
+			for k, v := range fields {
+				if v != nil {
+					nonNull[k] = v
+				}
+			}
+			export := h.Export[kind][inst]
+			if len(nonNull) == 0 && len(export) == 0 {
 				continue
 			}
-			names := sortedKeysMap(insts)
-			for _, inst := range names {
-				fields := insts[inst]
-				nonNull := make(map[string]any, len(fields))
-				for k, v := range fields {
-					if v != nil {
-						nonNull[k] = v
-					}
-				}
-				if len(nonNull) == 0 {
-					continue
-				}
-				fmt.Fprintf(&buf, "%s %q {\n", kind, inst)
-				fk := sortedKeysAny(nonNull)
-				for _, k := range fk {
-					lit := renderValue(nonNull[k], 1, false)
-					fmt.Fprintf(&buf, "  %-8s => %s,\n", k, lit)
-				}
-				fmt.Fprintln(&buf, "}\n")
+			var b strings.Builder
+			if err := renderResource(&b, opts, kind, inst, nonNull, export); err != nil {
+				return nil, fmt.Errorf("%s %q: %w", kind, inst, err)
 			}
+			b.WriteString("}\n\n")
+			f.res = append(f.res, stmt{key: kind + "\x00" + inst, text: b.String()})
 		}
 	}
 
-	return buf.Bytes(), nil
+	// collected resources
+	for _, c := range h.Collect {
+		srcs, err := sources(name, c)
+		if err != nil {
+			return nil, err
+		}
+		var b strings.Builder
+		if err := renderCollect(&b, opts, c, srcs); err != nil {
+			return nil, fmt.Errorf("host %q: %s: %w", name, describeCollect(c), err)
+		}
+		f.collect = append(f.collect, stmt{key: b.String(), text: b.String()})
+	}
+
+	// modules read from by __secret references and called by __call nodes
+	modules := make(map[string]bool)
+	neededModules(h.Vars, modules)
+	for _, insts := range h.Res {
+		for _, params := range insts {
+			neededModules(params, modules)
+		}
+	}
+	for _, c := range h.Collect {
+		neededModules(c.Params, modules)
+	}
+	f.imports = addImports(f.imports, modules)
+	return f, nil
 }
 
-func sortedKeysMap[K ~string, V any](m map[K]V) []string {
-	keys := make([]string, 0, len(m))
-	for k := range m {
-		keys = append(keys, string(k))
+func renderResource(b *strings.Builder, opts RenderOptions, kind, name string, params map[string]any, export []string) error {
+	title, err := quoteString(name)
+	if err != nil {
+		return err
 	}
-	sort.Strings(keys)
-	return keys
+	fmt.Fprintf(b, "%s %s {\n", kind, title)
+	if err := renderParams(b, opts, kind, omitNameDefaults(opts.Schema, kind, name, params)); err != nil {
+		return err
+	}
+	if len(export) > 0 {
+		hosts, err := renderValue(sortedHosts(export), nil, 1)
+		if err != nil {
+			return fmt.Errorf("Meta:export: %w", err)
+		}
+		fmt.Fprintf(b, "  Meta:export => %s,\n", hosts)
+	}
+	return nil
 }
-func sortedKeysAny(m map[string]any) []string {
-	keys := make([]string, 0, len(m))
-	for k := range m {
-		keys = append(keys, k)
+
+// omitNameDefaults drops the params that only repeat the resource name mgmt
+// would use for them anyway, such as a file's path.
+func omitNameDefaults(s Schema, kind, name string, params map[string]any) map[string]any {
+	out := make(map[string]any, len(params))
+	for k, v := range params {
+		if f := s.field(kind, k); f != nil && f.NameDefault && v == name {
+			continue
+		}
+		out[k] = v
 	}
-	sort.Strings(keys)
-	return keys
+	return out
 }
 
-func renderValue(v any, indentLevel int, topVar bool) string {
-	switch x := v.(type) {
-	case nil:
-		return "null"
-	case string:
-		if topVar {
-			return strings.TrimSpace(x)
-		}
-		return strconv.Quote(x)
-	case bool:
-		if x {
-			return "true"
-		}
-		return "false"
-	case json.Number:
-		if _, err := x.Int64(); err == nil {
-			return x.String()
-		}
-		if _, err := x.Float64(); err == nil {
-			return x.String()
-		}
-		return strconv.Quote(x.String())
-	case float64:
-		s := fmt.Sprintf("%v", x)
-		if strings.HasSuffix(s, ".0") {
-			s = strings.TrimSuffix(s, ".0")
-		}
-		return s
-	case int, int8, int16, int32, int64:
-		return fmt.Sprintf("%d", x)
-	case uint, uint8, uint16, uint32, uint64:
-		return fmt.Sprintf("%d", x)
-	case []any:
-		if len(x) == 0 {
-			return "[]"
+// renderParams writes the non-null params of a resource or collect body of
+// the given kind.
+func renderParams(b *strings.Builder, opts RenderOptions, kind string, params map[string]any) error {
+	for _, k := range sortedKeysAny(params) {
+		if params[k] == nil {
+			continue
 		}
-		var b strings.Builder
-		b.WriteString("[")
-		for i, el := range x {
-			if i > 0 {
-				b.WriteString(", ")
+		if !isParamName(k) {
+			return fmt.Errorf("param %q is not a valid MCL identifier", k)
+		}
+		if !isSecret(params[k]) && !opts.AllowLiteralSecrets && sensitive(k, opts.Schema.field(kind, k), params[k]) {
+			return fmt.Errorf("param %s looks sensitive; use a %s reference instead of a literal, which would end up in the Nix store", k, secretTag)
+		}
+		lit, err := renderValue(params[k], opts.Schema.paramType(kind, k), 1)
+		if err != nil {
+			return fmt.Errorf("param %s: %w", k, err)
+		}
+		fmt.Fprintf(b, "  %-8s => %s,\n", k, lit)
+	}
+	return nil
+}
+
+// isParamName reports whether k can be written as a param name: an
+// identifier, or a Meta:<identifier> metaparam.
+func isParamName(k string) bool {
+	if meta, ok := strings.CutPrefix(k, "Meta:"); ok {
+		return isIdent(meta)
+	}
+	return isIdent(k) || k == "Meta"
+}
+
+func (f *mclFile) render(title string) ([]byte, error) {
+	var buf bytes.Buffer
+	fmt.Fprintf(&buf, "# %s\n\n", title)
+	if len(f.imports) > 0 || len(f.modules) > 0 {
+		for _, s := range f.imports {
+			path, err := quoteString(s)
+			if err != nil {
+				return nil, fmt.Errorf("import: %w", err)
 			}
-			b.WriteString(renderValue(el, indentLevel+1, false))
+			fmt.Fprintf(&buf, "import %s\n", path)
 		}
-		b.WriteString("]")
-		return b.String()
-	case map[string]any:
-		if len(x) == 0 {
-			return "{}"
+		for _, s := range f.modules {
+			path, err := quoteString(s)
+			if err != nil {
+				return nil, fmt.Errorf("import: %w", err)
+			}
+			fmt.Fprintf(&buf, "import %s as *\n", path)
 		}
-		keys := make([]string, 0, len(x))
-		for k := range x {
-			keys = append(keys, k)
+		fmt.Fprintln(&buf)
+	}
+	// Imports can't be nested in a class, so those that open raw blocks are
+	// written here instead.
+	raw := f.raw
+	if f.class != "" {
+		raw = make([]stmt, len(f.raw))
+		var imports []string
+		for i, s := range f.raw {
+			var head string
+			head, s.text = splitRawImports(s.text)
+			imports = append(imports, head)
+			raw[i] = s
 		}
-		sort.Strings(keys)
-		indent := strings.Repeat("  ", indentLevel)
-		inner := strings.Repeat("  ", indentLevel+1)
-		var b strings.Builder
-		b.WriteString("{\n")
-		for _, k := range keys {
-			b.WriteString(inner)
-			if isBareIdent(k) {
-				b.WriteString(k)
-			} else {
-				b.WriteString(strconv.Quote(k))
+		if head := strings.Join(imports, ""); head != "" {
+			buf.WriteString(head)
+			fmt.Fprintln(&buf)
+		}
+	}
+	if len(f.vars) > 0 {
+		for _, s := range f.vars {
+			buf.WriteString(s.text)
+		}
+		fmt.Fprintln(&buf)
+	}
+	if f.class == "" {
+		for _, group := range [][]stmt{f.raw, f.res, f.collect} {
+			for _, s := range group {
+				buf.WriteString(s.text)
 			}
-			b.WriteString(": ")
-			b.WriteString(renderValue(x[k], indentLevel+1, false))
-			b.WriteString(",\n")
-		}
-		b.WriteString(indent)
-		b.WriteString("}")
-		return b.String()
-	default:
-		buf, err := json.Marshal(x)
-		if err != nil {
-			return strconv.Quote(fmt.Sprintf("%v", x))
 		}
-		return string(buf)
+		return buf.Bytes(), nil
 	}
-}
 
-func isBareIdent(s string) bool {
-	if s == "" {
-		return false
+	var body strings.Builder
+	for _, inc := range f.includes {
+		fmt.Fprintf(&body, "include %s\n", inc)
+	}
+	if len(f.includes) > 0 {
+		body.WriteString("\n")
+	}
+	for _, group := range [][]stmt{f.res, f.collect} {
+		for _, s := range group {
+			body.WriteString(s.text)
+		}
+	}
+	fmt.Fprintf(&buf, "class %s {\n", f.class)
+	if b := strings.TrimRight(body.String(), "\n"); b != "" {
+		buf.WriteString(indentLines(b))
+		buf.WriteString("\n")
 	}
-	for i, r := range s {
-		if !(r == '_' || r == '-' || r == '.' || r == ':' || r == '/' || r == '$' || isAlphaNum(r)) {
-			return false
+	// Raw blocks are copied verbatim: re-indenting them could alter
+	// multi-line string literals.
+	for _, s := range raw {
+		buf.WriteString(s.text)
+	}
+	buf.WriteString("}\n")
+	return buf.Bytes(), nil
+}
+
+// splitRawImports splits the import statements a raw block starts with, and
+// the blank lines and comments around them, from the rest of the block.
+func splitRawImports(s string) (imports, rest string) {
+	lines := strings.SplitAfter(s, "\n")
+	n := 0
+	for i, l := range lines {
+		t := strings.TrimSpace(l)
+		if strings.HasPrefix(t, "import ") || strings.HasPrefix(t, "import\t") {
+			n = i + 1
+		} else if t != "" && !strings.HasPrefix(t, "#") {
+			break
 		}
-		if i == 0 && (r >= '0' && r <= '9') {
-			return false
+	}
+	return strings.Join(lines[:n], ""), strings.TrimLeft(strings.Join(lines[n:], ""), "\n")
+}
+
+func indentLines(s string) string {
+	lines := strings.Split(s, "\n")
+	for i, l := range lines {
+		if l != "" {
+			lines[i] = "  " + l
 		}
 	}
-	return true
+	return strings.Join(lines, "\n")
 }
-func isAlphaNum(r rune) bool {
-	return (r >= 'a' && r <= 'z') ||
-		(r >= 'A' && r <= 'Z') ||
-		(r >= '0' && r <= '9')
+
+func sortedKeysMap[K ~string, V any](m map[K]V) []string {
+	keys := make([]string, 0, len(m))
+	for k := range m {
+		keys = append(keys, string(k))
+	}
+	sort.Strings(keys)
+	return keys
+}
+func sortedKeysAny(m map[string]any) []string {
+	keys := make([]string, 0, len(m))
+	for k := range m {
+		keys = append(keys, k)
+	}
+	sort.Strings(keys)
+	return keys
 }
@@ -0,0 +1,375 @@
+package mclgen
+
+import (
+	"encoding/json"
+	"github.com/karpfediem/rx.nix/codegen/internal/ir"
+	"github.com/karpfediem/rx.nix/codegen/internal/parse"
+	"github.com/karpfediem/rx.nix/codegen/internal/testutil"
+	"os"
+	"path/filepath"
+	"reflect"
+	"sort"
+	"strings"
+	"testing"
+)
+
+func renderGolden(t *testing.T, name string, opts RenderOptions) {
+	t.Helper()
+	raw, err := os.ReadFile("testdata/" + name + ".ir")
+	if err != nil {
+		t.Fatal(err)
+	}
+	var h ir.Host
+	if err := ir.Decode(raw, &h); err != nil {
+		t.Fatal(err)
+	}
+	got, err := RenderHost("demo", h, opts)
+	if err != nil {
+		t.Fatal(err)
+	}
+	testutil.Golden(t, "testdata/"+name+".mcl.golden", got)
+}
+
+func TestRenderHostGolden(t *testing.T) {
+	renderGolden(t, "host", RenderOptions{})
+}
+
+// Params typed by the manifest render as map or struct literals by their Go
+// type, whatever their keys look like, params that repeat the resource name
+// they default to are left out, function calls import their module and
+// constants render as $const variables.
+func TestRenderHostSchema(t *testing.T) {
+	resources, _, err := parse.ParseResources(testutil.MgmtFixture, parse.Options{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	opts := RenderOptions{Schema: NewSchema(resources)}
+	renderGolden(t, "typed", opts)
+
+	for _, params := range []map[string]any{
+		{"port": json.Number("80.5")},
+		{"limit": json.Number("9223372036854775808")},
+		{"ratio": json.Number("1e400")},
+	} {
+		h := ir.Host{Res: map[string]map[string]map[string]any{"test:exotic": {"x": params}}}
+		if out, err := RenderHost("demo", h, opts); err == nil {
+			t.Errorf("%v: expected an error, got\n%s", params, out)
+		}
+	}
+}
+
+func TestRenderHostCollectNeedsSources(t *testing.T) {
+	h := ir.Host{Collect: []ir.Collect{{Kind: "file"}}}
+	if _, err := RenderHost("demo", h, RenderOptions{}); err == nil {
+		t.Fatal("expected an error for a collect without name and from")
+	}
+}
+
+// A host rendered on its own from a document collects what the other hosts
+// export to it, as the per-host deploys of the flake do.
+func TestRenderDocumentHost(t *testing.T) {
+	doc := ir.Document{
+		"web": {
+			Res:    map[string]map[string]map[string]any{"file": {"/etc/motd": {"content": "hi"}}},
+			Export: map[string]map[string][]string{"file": {"/etc/motd": {"db"}}},
+		},
+		"db": {Collect: []ir.Collect{{Kind: "file", From: []string{"web"}}}},
+	}
+	out, err := RenderDocumentHost(doc, "db", RenderOptions{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if want := `struct{name => "/etc/motd", host => "web",}`; !strings.Contains(string(out), want) {
+		t.Errorf("rendered MCL does not collect %s:\n%s", want, out)
+	}
+	if _, err := RenderDocumentHost(doc, "cache", RenderOptions{}); err == nil {
+		t.Error("expected an error for a host that is not in the document")
+	}
+}
+
+// Exports and collects name hosts as mgmt knows them, by their hostname,
+// not by their key in the document.
+func TestRenderDocumentHostnames(t *testing.T) {
+	doc := ir.Document{
+		"web-1": {
+			Hostname: "web1",
+			Res:      map[string]map[string]map[string]any{"file": {"/etc/motd": {"content": "hi"}}},
+			Export:   map[string]map[string][]string{"file": {"/etc/motd": {"db-1"}}},
+		},
+		"db-1": {Hostname: "db1", Collect: []ir.Collect{{Kind: "file"}}},
+	}
+	out, err := RenderDocument(doc, DocumentOptions{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if want := `Meta:export => ["db1"]`; !strings.Contains(string(out["web-1.mcl"]), want) {
+		t.Errorf("web-1.mcl does not export with %s:\n%s", want, out["web-1.mcl"])
+	}
+	if want := `host => "web1"`; !strings.Contains(string(out["db-1.mcl"]), want) {
+		t.Errorf("db-1.mcl does not collect with %s:\n%s", want, out["db-1.mcl"])
+	}
+}
+
+func TestCheckExchangeUnknownExportHost(t *testing.T) {
+	doc := ir.Document{
+		"web": {
+			Res:    map[string]map[string]map[string]any{"file": {"/etc/motd": {"content": "hi"}}},
+			Export: map[string]map[string][]string{"file": {"/etc/motd": {"dbb"}}},
+		},
+		"db": {},
+	}
+	err := CheckExchange(doc)
+	if err == nil || !strings.Contains(err.Error(), `unknown host "dbb"`) {
+		t.Errorf("CheckExchange = %v, want an error for the unknown host", err)
+	}
+	doc["web"].Export["file"]["/etc/motd"] = []string{"*"}
+	if err := CheckExchange(doc); err != nil {
+		t.Errorf("exporting to every host: %v", err)
+	}
+}
+
+// Only statements that don't depend on what a host defines on its own are
+// moved into shared.mcl. In a string, only ${n} uses $n.
+func TestRenderDocumentShared(t *testing.T) {
+	host := func(n string, imports ...string) ir.Host {
+		return ir.Host{
+			Imports: imports,
+			Vars:    map[string]any{"n": n, "m": "$n + 1", "c": json.Number("3"), "d": "$c * 2", "s": `fmt.printf("%d", $c)`, "l": `"costs $n \${n}"`, "i": `"n is ${n}"`},
+			Raw:     []string{`print "p" { msg => "$n", }`},
+			Res:     map[string]map[string]map[string]any{"file": {"/etc/motd": {"content": "hi"}}},
+		}
+	}
+	doc := ir.Document{"a": host("1", "fmt"), "b": host("2")}
+	out, err := RenderDocument(doc, DocumentOptions{Shared: true})
+	if err != nil {
+		t.Fatal(err)
+	}
+	shared := string(out["shared.mcl"])
+	for _, want := range []string{"$c = 3", "$d = $c * 2", `$l = "costs $n \${n}"`, `file "/etc/motd"`} {
+		if !strings.Contains(shared, want) {
+			t.Errorf("shared.mcl lacks %s:\n%s", want, shared)
+		}
+	}
+	for _, host := range []string{"a.mcl", "b.mcl"} {
+		for _, want := range []string{"$m = $n + 1", "$s = fmt.printf", `$i = "n is ${n}"`, `print "p"`} {
+			if !strings.Contains(string(out[host]), want) {
+				t.Errorf("%s lacks %s:\n%s", host, want, out[host])
+			}
+		}
+	}
+}
+
+func TestRenderDocumentBadGroups(t *testing.T) {
+	doc := ir.Document{"a": {}, "b": {}, "shared": {}, "shared-x": {}}
+	for name, opts := range map[string]DocumentOptions{
+		"path in group name":      {Groups: map[string][]string{"../a": {"a", "b"}}},
+		"group file is a host's":  {Groups: map[string][]string{"x": {"a", "b"}}},
+		"shared file is a host's": {Shared: true},
+		"empty group name":        {Groups: map[string][]string{"": {"a"}}},
+	} {
+		if _, err := RenderDocument(doc, opts); err == nil {
+			t.Errorf("%s: expected an error", name)
+		}
+	}
+}
+
+func TestRenderDocumentDispatchCollisions(t *testing.T) {
+	res := map[string]map[string]map[string]any{"file": {"/etc/motd": {"content": "hi"}}}
+	for name, tc := range map[string]struct {
+		doc  ir.Document
+		opts DocumentOptions
+	}{
+		"same hostname":     {ir.Document{"a": {Hostname: "web"}, "web": {}}, DocumentOptions{}},
+		"same import name":  {ir.Document{"a-b": {}, "a_b": {}}, DocumentOptions{}},
+		"same shared class": {ir.Document{"a": {Res: res}, "b": {Res: res}}, DocumentOptions{Groups: map[string][]string{"x-y": {"a", "b"}, "x_y": {"a", "b"}}}},
+	} {
+		tc.opts.Dispatch = true
+		if _, err := RenderDocument(tc.doc, tc.opts); err == nil {
+			t.Errorf("%s: expected an error", name)
+		}
+	}
+}
+
+// Imports opening a raw block stay at the top level of a host's file when
+// its statements are wrapped in a class.
+func TestRenderDocumentRawImports(t *testing.T) {
+	raw := "import \"fmt\"\n\nprint \"p\" {\n  msg => fmt.printf(\"%d\", 1),\n}\n"
+	doc := ir.Document{"a": {Raw: []string{raw}}}
+	out, err := RenderDocument(doc, DocumentOptions{Dispatch: true})
+	if err != nil {
+		t.Fatal(err)
+	}
+	got := string(out["a.mcl"])
+	imp, class := strings.Index(got, `import "fmt"`), strings.Index(got, "class host {")
+	if imp < 0 || class < 0 || imp > class || !strings.Contains(got[class:], `print "p"`) {
+		t.Errorf("import is not at the top level:\n%s", got)
+	}
+}
+
+func TestRenderHostUnrepresentable(t *testing.T) {
+	for name, params := range map[string]map[string]any{
+		"NUL in a value":    {"content": "a\x00b"},
+		"invalid UTF-8":     {"content": "\xff"},
+		"non-identifier":    {"no-dash": "x"},
+		"unsupported value": {"content": []string{"x"}},
+	} {
+		h := ir.Host{Res: map[string]map[string]map[string]any{"file": {"/tmp/x": params}}}
+		if out, err := RenderHost("demo", h, RenderOptions{}); err == nil {
+			t.Errorf("%s: expected an error, got\n%s", name, out)
+		}
+	}
+}
+
+func TestRenderValueTags(t *testing.T) {
+	for _, tc := range []struct {
+		v    any
+		want string
+	}{
+		{map[string]any{"a": "x"}, "struct{\n  a => \"x\",\n}"},
+		{map[string]any{"a/b": "x"}, "{\n  \"a/b\" => \"x\",\n}"},
+		{map[string]any{}, "{}"},
+		{map[string]any{mapTag: map[string]any{"a": "x"}}, "{\n  \"a\" => \"x\",\n}"},
+		{map[string]any{structTag: map[string]any{}}, "struct{}"},
+	} {
+		got, err := renderValue(tc.v, nil, 0)
+		if err != nil {
+			t.Errorf("renderValue(%v): %v", tc.v, err)
+			continue
+		}
+		if got != tc.want {
+			t.Errorf("renderValue(%v) = %q, want %q", tc.v, got, tc.want)
+		}
+	}
+	for _, v := range []any{
+		map[string]any{structTag: map[string]any{"a/b": "x"}},
+		map[string]any{mapTag: "x"},
+	} {
+		if got, err := renderValue(v, nil, 0); err == nil {
+			t.Errorf("renderValue(%v) = %s, want an error", v, got)
+		}
+	}
+}
+
+var fileSecret = map[string]any{secretTag: map[string]any{"provider": "file", "path": "/run/secrets/x"}}
+
+func TestRenderHostSecrets(t *testing.T) {
+	resources, _, err := parse.ParseResources(testutil.MgmtFixture, parse.Options{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	schema := NewSchema(resources)
+	for name, tc := range map[string]struct {
+		kind   string
+		params map[string]any
+		schema Schema
+	}{
+		"by name": {"svc", map[string]any{"db_password": "hunter2"}, nil},
+		"by doc":  {"user", map[string]any{"shadow": "$6$salt$hash"}, schema},
+		"nested":  {"svc", map[string]any{"api_token": []any{"x"}}, nil},
+		"mixed":   {"svc", map[string]any{"api_token": []any{fileSecret, "x"}}, nil},
+	} {
+		h := ir.Host{Res: map[string]map[string]map[string]any{tc.kind: {"x": tc.params}}}
+		if out, err := RenderHost("demo", h, RenderOptions{Schema: tc.schema}); err == nil {
+			t.Errorf("%s: expected a literal secret to be refused, got\n%s", name, out)
+		}
+		if _, err := RenderHost("demo", h, RenderOptions{Schema: tc.schema, AllowLiteralSecrets: true}); err != nil {
+			t.Errorf("%s: with AllowLiteralSecrets: %v", name, err)
+		}
+	}
+
+	// Only strings can take a secret reference, so other params are never
+	// refused, whatever their name or doc say.
+	password := NewSchema([]parse.ResourceInfo{{Name: "password", Fields: []parse.FieldInfo{
+		{GoName: "Saved", LangName: "saved", GoType: "bool", Doc: "Saved is true once the password is saved."},
+		{GoName: "Length", LangName: "length", GoType: "uint16", Doc: "Length of the generated password."},
+	}}})
+	for name, tc := range map[string]struct {
+		params map[string]any
+		schema Schema
+	}{
+		"bool by doc":      {map[string]any{"saved": true}, password},
+		"int by doc":       {map[string]any{"length": json.Number("16")}, password},
+		"bool by name":     {map[string]any{"insecure_password": true}, nil},
+		"list without str": {map[string]any{"api_tokens": []any{json.Number("1")}}, nil},
+	} {
+		h := ir.Host{Res: map[string]map[string]map[string]any{"password": {"p": tc.params}}}
+		if _, err := RenderHost("demo", h, RenderOptions{Schema: tc.schema}); err != nil {
+			t.Errorf("%s: %v", name, err)
+		}
+	}
+
+	// Secrets nested in lists and maps stand in for the literals.
+	for _, v := range []any{
+		[]any{fileSecret},
+		map[string]any{"a": fileSecret, "b": []any{fileSecret}},
+		map[string]any{mapTag: map[string]any{"a": fileSecret}},
+	} {
+		h := ir.Host{Res: map[string]map[string]map[string]any{"svc": {"x": {"api_token": v}}}}
+		if _, err := RenderHost("demo", h, RenderOptions{}); err != nil {
+			t.Errorf("%v: %v", v, err)
+		}
+	}
+
+	for _, ref := range []map[string]any{
+		{"provider": "vault", "path": "x"},
+		{"provider": "file"},
+		{"provider": "env", "name": ""},
+	} {
+		h := ir.Host{Res: map[string]map[string]map[string]any{"file": {"x": {"content": map[string]any{secretTag: ref}}}}}
+		if out, err := RenderHost("demo", h, RenderOptions{}); err == nil {
+			t.Errorf("%v: expected an error, got\n%s", ref, out)
+		}
+	}
+}
+
+func TestRenderHostEncryptedSecrets(t *testing.T) {
+	renderGolden(t, "secrets", RenderOptions{})
+
+	ref := func(k, v string) map[string]any {
+		return map[string]any{secretTag: map[string]any{"provider": "age", k: v}}
+	}
+	file := filepath.Join(t.TempDir(), "db.age")
+	if err := os.WriteFile(file, []byte("encrypted file"), 0o600); err != nil {
+		t.Fatal(err)
+	}
+	h := ir.Host{Res: map[string]map[string]map[string]any{"file": {
+		"/a": {"content": ref("file", file)},
+		"/b": {"content": ref("ciphertext", "encrypted inline")},
+	}}}
+	if out, err := RenderHost("demo", h, RenderOptions{}); err == nil {
+		t.Errorf("expected an error without a secretKey, got\n%s", out)
+	}
+
+	payloads, err := SecretPayloads(h)
+	if err != nil {
+		t.Fatal(err)
+	}
+	var got []string
+	for path, data := range payloads {
+		if !strings.HasPrefix(path, "files/secrets/") || !strings.HasSuffix(path, ".age") {
+			t.Errorf("unexpected payload path %s", path)
+		}
+		got = append(got, string(data))
+	}
+	sort.Strings(got)
+	if want := []string{"encrypted file", "encrypted inline"}; !reflect.DeepEqual(got, want) {
+		t.Errorf("payloads = %q, want %q", got, want)
+	}
+
+	h.SecretKey = "/var/lib/rx/age.key"
+	out, err := RenderHost("demo", h, RenderOptions{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	// The host decrypts each payload into a file named after it, which is
+	// all the MCL reads.
+	for path := range payloads {
+		want := `os.readfile("` + SecretRunDir + "/" + strings.TrimPrefix(path, "files/secrets/") + `")`
+		if strings.Count(string(out), want) != 1 {
+			t.Errorf("rendered MCL does not contain %s once:\n%s", want, out)
+		}
+	}
+	if strings.Contains(string(out), "exec") {
+		t.Errorf("rendered MCL decrypts secrets itself:\n%s", out)
+	}
+}
@@ -0,0 +1,93 @@
+package mclgen
+
+import (
+	"github.com/karpfediem/rx.nix/codegen/internal/parse"
+	"go/ast"
+	"go/parser"
+)
+
+// Schema holds every resource param, keyed by kind and param name, so that
+// values can be rendered as the MCL type mgmt expects.
+type Schema map[string]map[string]parse.FieldInfo
+
+// NewSchema builds a Schema from parsed resources, e.g. the manifest written
+// by cmd/nixos.
+func NewSchema(resources []parse.ResourceInfo) Schema {
+	s := make(Schema, len(resources))
+	for _, r := range resources {
+		params := make(map[string]parse.FieldInfo, len(r.Fields))
+		for _, f := range r.Fields {
+			params[f.LangName] = f
+		}
+		s[r.Name] = params
+	}
+	return s
+}
+
+// valueType is as much of a Go type as rendering needs. A nil *valueType
+// means the type is unknown and the value is rendered by its own shape.
+type valueType struct {
+	kind valueKind
+	elem *valueType // list element or map value
+}
+
+type valueKind int
+
+const (
+	listValue valueKind = iota
+	mapValue
+	structValue
+	intValue
+	floatValue
+)
+
+func (s Schema) field(kind, param string) *parse.FieldInfo {
+	f, ok := s[kind][param]
+	if !ok {
+		return nil
+	}
+	return &f
+}
+
+func (s Schema) paramType(kind, param string) *valueType {
+	f := s.field(kind, param)
+	if f == nil {
+		return nil
+	}
+	e, err := parser.ParseExpr(f.GoType)
+	if err != nil {
+		return nil
+	}
+	return typeOf(e)
+}
+
+func typeOf(e ast.Expr) *valueType {
+	switch x := e.(type) {
+	case *ast.StarExpr:
+		return typeOf(x.X)
+	case *ast.ParenExpr:
+		return typeOf(x.X)
+	case *ast.ArrayType:
+		return &valueType{kind: listValue, elem: typeOf(x.Elt)}
+	case *ast.MapType:
+		return &valueType{kind: mapValue, elem: typeOf(x.Value)}
+	case *ast.StructType:
+		return &valueType{kind: structValue}
+	case *ast.Ident:
+		switch x.Name {
+		case "int", "int8", "int16", "int32", "int64",
+			"uint", "uint8", "uint16", "uint32", "uint64":
+			return &valueType{kind: intValue}
+		case "float32", "float64":
+			return &valueType{kind: floatValue}
+		}
+	}
+	return nil
+}
+
+func (t *valueType) elemType() *valueType {
+	if t == nil {
+		return nil
+	}
+	return t.elem
+}
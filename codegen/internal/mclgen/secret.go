@@ -0,0 +1,146 @@
+package mclgen
+
+import (
+	"fmt"
+	"github.com/karpfediem/rx.nix/codegen/internal/parse"
+	"regexp"
+	"slices"
+	"sort"
+)
+
+// secretTag marks an IR value that is read on the host at apply time instead
+// of being written into the generated MCL (and so into the Nix store), e.g.
+// {"__secret": {"provider": "file", "path": "/run/secrets/db"}}.
+const secretTag = "__secret"
+
+// secretProviders maps each provider to the MCL module its runtime read
+// needs, the key naming what to read, and the function reading it.
+var secretProviders = map[string]struct{ module, key, fn string }{
+	"file": {"os", "path", "os.readfile"},
+	"env":  {"sys", "name", "sys.getenv"},
+}
+
+// secretRef returns the reference held by v, if v is a secret node.
+func secretRef(v any) (map[string]any, bool) {
+	m, ok := v.(map[string]any)
+	if !ok || len(m) != 1 {
+		return nil, false
+	}
+	ref, ok := m[secretTag].(map[string]any)
+	return ref, ok
+}
+
+// isSecret reports whether v is read at apply time rather than a literal:
+// it is a secret, or a list or map of values holding at least one secret and
+// no literal strings.
+func isSecret(v any) bool {
+	secret, literal := secretLeaves(v)
+	return secret && !literal
+}
+
+// secretLeaves reports whether v holds secrets and literal strings.
+func secretLeaves(v any) (secret, literal bool) {
+	if _, ok := v.(decrypt); ok {
+		return true, false
+	}
+	if _, ok := secretRef(v); ok {
+		return true, false
+	}
+	switch x := v.(type) {
+	case string:
+		return false, true
+	case []any:
+		for _, el := range x {
+			s, l := secretLeaves(el)
+			secret, literal = secret || s, literal || l
+		}
+	case map[string]any:
+		for _, el := range x {
+			s, l := secretLeaves(el)
+			secret, literal = secret || s, literal || l
+		}
+	}
+	return secret, literal
+}
+
+func renderSecret(ref map[string]any) (string, error) {
+	provider, _ := ref["provider"].(string)
+	p, ok := secretProviders[provider]
+	if !ok {
+		return "", fmt.Errorf("%s: unknown provider %q (expected file, env, age or sops)", secretTag, provider)
+	}
+	arg, _ := ref[p.key].(string)
+	if arg == "" {
+		return "", fmt.Errorf("%s: provider %s needs a %s", secretTag, provider, p.key)
+	}
+	lit, err := quoteString(arg)
+	if err != nil {
+		return "", fmt.Errorf("%s: %w", secretTag, err)
+	}
+	return p.fn + "(" + lit + ")", nil
+}
+
+// neededModules adds the modules needed by the secret and call nodes within
+// v.
+func neededModules(v any, into map[string]bool) {
+	if ref, ok := secretRef(v); ok {
+		provider, _ := ref["provider"].(string)
+		if p, ok := secretProviders[provider]; ok {
+			into[p.module] = true
+		}
+		return
+	}
+	if c, ok := callRef(v); ok {
+		if module, _ := c["module"].(string); module != "" {
+			into[module] = true
+		}
+		neededModules(c["args"], into)
+		return
+	}
+	switch x := v.(type) {
+	case decrypt:
+		into["os"] = true
+	case []any:
+		for _, el := range x {
+			neededModules(el, into)
+		}
+	case map[string]any:
+		for _, el := range x {
+			neededModules(el, into)
+		}
+	}
+}
+
+// addImports merges modules into the sorted import list.
+func addImports(imports []string, modules map[string]bool) []string {
+	for m := range modules {
+		if !slices.Contains(imports, m) {
+			imports = append(imports, m)
+		}
+	}
+	sort.Strings(imports)
+	return imports
+}
+
+var (
+	sensitiveName = regexp.MustCompile(`(?i)pass(word|wd|phrase)|secret|token|private_?key|api_?key|credential`)
+	sensitiveDoc  = regexp.MustCompile(`(?i)\b(password|passphrase|secret|private key|api key|credential)s?\b`)
+)
+
+// sensitive reports whether a param holding v looks like it holds a secret,
+// judging by its name and, if known, its documentation. Only string params
+// can take a secret reference, so others never are: by their type if known,
+// else by whether v holds any literal string.
+func sensitive(param string, field *parse.FieldInfo, v any) bool {
+	if field != nil {
+		if field.GoType != "string" && field.GoType != "*string" {
+			return false
+		}
+	} else if _, literal := secretLeaves(v); !literal {
+		return false
+	}
+	if sensitiveName.MatchString(param) {
+		return true
+	}
+	return field != nil && sensitiveDoc.MatchString(field.Doc)
+}
@@ -0,0 +1,212 @@
+package mclgen
+
+import (
+	"fmt"
+	"github.com/karpfediem/rx.nix/codegen/internal/ir"
+	"regexp"
+	"slices"
+	"sort"
+	"strings"
+)
+
+// DocumentOptions controls how a multi-host document is split into files.
+type DocumentOptions struct {
+	// Shared moves statements common to every host into shared.mcl.
+	Shared bool
+	// Groups maps a group name to its hosts. Statements common to all hosts
+	// of a group are moved into shared-<name>.mcl. Groups are processed after
+	// the all-hosts module, in name order; a statement is only ever moved
+	// into the first module that claims it.
+	Groups map[string][]string
+	// Dispatch wraps each host's statements in a class and adds a main.mcl
+	// that includes the class matching sys.hostname(), so a single deploy
+	// can be pushed to every host of the document.
+	Dispatch bool
+
+	RenderOptions
+}
+
+type sharedGroup struct {
+	file  string
+	hosts []string
+}
+
+// groupName matches the names of groups, which become part of a file name.
+var groupName = regexp.MustCompile(`^[A-Za-z0-9][A-Za-z0-9_-]*$`)
+
+// sharedGroups returns the shared modules opts asks for, rejecting groups
+// whose file would escape the deploy directory or overwrite a host's file.
+func sharedGroups(doc ir.Document, opts DocumentOptions) ([]sharedGroup, error) {
+	var groups []sharedGroup
+	if opts.Shared {
+		groups = append(groups, sharedGroup{file: "shared.mcl", hosts: sortedKeysMap(doc)})
+	}
+	for _, name := range sortedKeysMap(opts.Groups) {
+		if !groupName.MatchString(name) {
+			return nil, fmt.Errorf("group %q: name must be letters, digits, - and _", name)
+		}
+		hosts := append([]string(nil), opts.Groups[name]...)
+		sort.Strings(hosts)
+		hosts = slices.Compact(hosts)
+		for _, hn := range hosts {
+			if _, ok := doc[hn]; !ok {
+				return nil, fmt.Errorf("group %q: unknown host %q", name, hn)
+			}
+		}
+		groups = append(groups, sharedGroup{file: "shared-" + name + ".mcl", hosts: hosts})
+	}
+	for _, g := range groups {
+		hn := strings.TrimSuffix(g.file, ".mcl")
+		if _, ok := doc[hn]; ok {
+			return nil, fmt.Errorf("host %q: file %s collides with a shared module", hn, g.file)
+		}
+	}
+	return groups, nil
+}
+
+// extractShared moves the statements common to all files into a new module,
+// which every file then imports. It returns nil if nothing is shared. Raw
+// blocks are never moved, as they may use anything their host defines, and a
+// var is only moved if the vars and imports it uses are moved too.
+func extractShared(files []*mclFile) *mclFile {
+	if len(files) < 2 {
+		return nil
+	}
+	shared := &mclFile{}
+	for _, imp := range files[0].imports {
+		if everyFile(files[1:], func(f *mclFile) bool { return slices.Contains(f.imports, imp) }) {
+			shared.imports = append(shared.imports, imp)
+		}
+	}
+	empty := true
+	for _, g := range []struct {
+		sel  func(*mclFile) *[]stmt
+		vars bool
+	}{
+		{func(f *mclFile) *[]stmt { return &f.vars }, true},
+		{func(f *mclFile) *[]stmt { return &f.res }, false},
+		{func(f *mclFile) *[]stmt { return &f.collect }, false},
+	} {
+		common := commonStmts(files, g.sel)
+		if g.vars {
+			common = closedVars(common, hostOnlyImports(files, shared.imports))
+		}
+		removeStmts(files, g.sel, common)
+		*g.sel(shared) = common
+		if len(common) > 0 {
+			empty = false
+		}
+	}
+	if empty {
+		return nil
+	}
+	return shared
+}
+
+// commonStmts returns the statements present in every file.
+func commonStmts(files []*mclFile, sel func(*mclFile) *[]stmt) []stmt {
+	var common []stmt
+	for _, s := range *sel(files[0]) {
+		if everyFile(files[1:], func(f *mclFile) bool { return slices.Contains(*sel(f), s) }) {
+			common = append(common, s)
+		}
+	}
+	return common
+}
+
+func removeStmts(files []*mclFile, sel func(*mclFile) *[]stmt, stmts []stmt) {
+	if len(stmts) == 0 {
+		return
+	}
+	for _, f := range files {
+		*sel(f) = slices.DeleteFunc(*sel(f), func(s stmt) bool { return slices.Contains(stmts, s) })
+	}
+}
+
+var (
+	// varName matches the name of a variable after its $.
+	varName = regexp.MustCompile(`^[A-Za-z_][A-Za-z0-9_]*`)
+	// moduleRef matches a use of an imported module, such as fmt.printf.
+	moduleRef = regexp.MustCompile(`\b([A-Za-z_][A-Za-z0-9_]*)\.[A-Za-z_]`)
+)
+
+// varRefs returns the names of the variables that expr uses: $name outside
+// string literals and ${name} inside them, which is the only form mgmt's
+// lang/interpolate expands; a bare $name or an escaped \${ in a string is
+// literal text.
+func varRefs(expr string) []string {
+	var names []string
+	inString := false
+	for i := 0; i < len(expr); i++ {
+		switch c := expr[i]; {
+		case inString && c == '\\':
+			i++
+		case c == '"':
+			inString = !inString
+		case c == '$':
+			rest := expr[i+1:]
+			if inString {
+				var ok bool
+				if rest, ok = strings.CutPrefix(rest, "{"); !ok {
+					continue
+				}
+			}
+			if name := varName.FindString(rest); name != "" {
+				names = append(names, name)
+			}
+		}
+	}
+	return names
+}
+
+// closedVars keeps the vars of common that only use vars kept too, or the
+// $const builtins, and no module of hostOnly.
+func closedVars(common []stmt, hostOnly map[string]bool) []stmt {
+	for {
+		keys := make(map[string]bool, len(common))
+		for _, s := range common {
+			keys[s.key] = true
+		}
+		kept := slices.DeleteFunc(slices.Clone(common), func(s stmt) bool {
+			expr := s.text[strings.Index(s.text, "=")+1:]
+			for _, name := range varRefs(expr) {
+				if !keys[name] && name != "const" {
+					return true
+				}
+			}
+			for _, m := range moduleRef.FindAllStringSubmatch(expr, -1) {
+				if hostOnly[m[1]] {
+					return true
+				}
+			}
+			return false
+		})
+		if len(kept) == len(common) {
+			return kept
+		}
+		common = kept
+	}
+}
+
+// hostOnlyImports returns the names that the imports of files other than
+// shared are used through.
+func hostOnlyImports(files []*mclFile, shared []string) map[string]bool {
+	names := make(map[string]bool)
+	for _, f := range files {
+		for _, imp := range f.imports {
+			if !slices.Contains(shared, imp) {
+				names[strings.TrimSuffix(imp[strings.LastIndex(imp, "/")+1:], ".mcl")] = true
+			}
+		}
+	}
+	return names
+}
+
+func everyFile(files []*mclFile, pred func(*mclFile) bool) bool {
+	for _, f := range files {
+		if !pred(f) {
+			return false
+		}
+	}
+	return true
+}
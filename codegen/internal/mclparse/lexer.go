@@ -0,0 +1,226 @@
+// Package mclparse is a small parser for the subset of mgmt's MCL that rx.nix
+// reads back: imports, variable bindings and resource blocks with literal
+// params. Everything else is kept as verbatim source text.
+//
+// mgmt's own parser (lang/parser) is generated by goyacc and nex and can only
+// be imported with the rest of the mgmt module, which the codegen, built
+// without dependencies, does not pull in. It also builds a full AST with no
+// source spans, while mcl2nix needs each statement's verbatim text to keep
+// what it can't convert. The cmd/mcl2nix goldens pin the behaviour.
+package mclparse
+
+import (
+	"fmt"
+	"strings"
+	"unicode/utf8"
+)
+
+type tokKind int
+
+const (
+	tokEOF tokKind = iota
+	tokIdent
+	tokVar
+	tokString
+	tokInt
+	tokFloat
+	tokPunct // { } [ ] ( ) , . : => = and operators
+)
+
+type token struct {
+	kind tokKind
+	text string // source text (for tokString: the decoded value)
+	pos  int    // byte offset of the token start
+	end  int    // byte offset after the token
+	line int
+
+	interpolated bool // tokString contains ${...}
+}
+
+// Pos is a position in the parsed source.
+type Pos struct {
+	Line   int
+	Column int
+}
+
+func (p Pos) String() string { return fmt.Sprintf("%d:%d", p.Line, p.Column) }
+
+// Error is a lexing or parsing error at a source position.
+type Error struct {
+	Pos Pos
+	Msg string
+}
+
+func (e *Error) Error() string { return e.Pos.String() + ": " + e.Msg }
+
+type lexer struct {
+	src  string
+	off  int
+	line int
+	toks []token
+}
+
+func lex(src string) ([]token, error) {
+	l := &lexer{src: src, line: 1}
+	for {
+		t, err := l.next()
+		if err != nil {
+			return nil, err
+		}
+		l.toks = append(l.toks, t)
+		if t.kind == tokEOF {
+			return l.toks, nil
+		}
+	}
+}
+
+func (l *lexer) errorf(off int, format string, args ...any) error {
+	return &Error{Pos: position(l.src, off), Msg: fmt.Sprintf(format, args...)}
+}
+
+func position(src string, off int) Pos {
+	line := 1 + strings.Count(src[:off], "\n")
+	col := off - strings.LastIndexByte(src[:off], '\n')
+	return Pos{Line: line, Column: col}
+}
+
+var puncts = []string{"=>", "->", "?:", "==", "!=", "<=", ">=", "&&", "||", "{", "}", "[", "]", "(", ")", ",", ".", ":", "=", "+", "-", "*", "/", "%", "<", ">", "!"}
+
+func (l *lexer) next() (token, error) {
+	// skip whitespace and comments
+	for l.off < len(l.src) {
+		c := l.src[l.off]
+		if c == '\n' {
+			l.line++
+			l.off++
+			continue
+		}
+		if c == ' ' || c == '\t' || c == '\r' {
+			l.off++
+			continue
+		}
+		if c == '#' {
+			for l.off < len(l.src) && l.src[l.off] != '\n' {
+				l.off++
+			}
+			continue
+		}
+		break
+	}
+	start := l.off
+	t := token{pos: start, line: l.line}
+	if l.off >= len(l.src) {
+		t.kind, t.end = tokEOF, start
+		return t, nil
+	}
+	c := l.src[l.off]
+	switch {
+	case c == '"':
+		s, interp, err := l.lexString()
+		if err != nil {
+			return t, err
+		}
+		t.kind, t.text, t.interpolated = tokString, s, interp
+	case c == '$':
+		l.off++
+		for l.off < len(l.src) && isIdentByte(l.src[l.off]) {
+			l.off++
+		}
+		if l.off == start+1 {
+			return t, l.errorf(start, "expected variable name after $")
+		}
+		t.kind, t.text = tokVar, l.src[start+1:l.off]
+	case isDigit(c):
+		for l.off < len(l.src) && isDigit(l.src[l.off]) {
+			l.off++
+		}
+		t.kind = tokInt
+		if l.off+1 < len(l.src) && l.src[l.off] == '.' && isDigit(l.src[l.off+1]) {
+			l.off++
+			for l.off < len(l.src) && isDigit(l.src[l.off]) {
+				l.off++
+			}
+			t.kind = tokFloat
+		}
+		t.text = l.src[start:l.off]
+	case isIdentByte(c):
+		for l.off < len(l.src) && isIdentByte(l.src[l.off]) {
+			l.off++
+		}
+		t.kind, t.text = tokIdent, l.src[start:l.off]
+	default:
+		for _, p := range puncts {
+			if strings.HasPrefix(l.src[l.off:], p) {
+				l.off += len(p)
+				t.kind, t.text = tokPunct, p
+				break
+			}
+		}
+		if t.kind != tokPunct {
+			r, _ := utf8.DecodeRuneInString(l.src[l.off:])
+			return t, l.errorf(start, "unexpected character %q", r)
+		}
+	}
+	t.end = l.off
+	return t, nil
+}
+
+// lexString reads a double-quoted string starting at l.off. Strings may span
+// several lines. As in mgmt, the only escapes are \\ \" \n \t \r and \$, and
+// a string must be valid UTF-8 without NUL bytes.
+func (l *lexer) lexString() (string, bool, error) {
+	start := l.off
+	l.off++ // opening quote
+	var b strings.Builder
+	interp := false
+	for {
+		if l.off >= len(l.src) {
+			return "", false, l.errorf(start, "unterminated string")
+		}
+		c := l.src[l.off]
+		switch {
+		case c == '"':
+			l.off++
+			return b.String(), interp, nil
+		case c == 0:
+			return "", false, l.errorf(l.off, "NUL byte in string")
+		case c >= utf8.RuneSelf:
+			r, n := utf8.DecodeRuneInString(l.src[l.off:])
+			if r == utf8.RuneError && n == 1 {
+				return "", false, l.errorf(l.off, "invalid UTF-8 in string")
+			}
+			b.WriteString(l.src[l.off : l.off+n])
+			l.off += n
+		case c == '\n':
+			l.line++
+			b.WriteByte(c)
+			l.off++
+		case c == '$' && l.off+1 < len(l.src) && l.src[l.off+1] == '{':
+			interp = true
+			b.WriteByte(c)
+			l.off++
+		case c == '\\':
+			if l.off+1 >= len(l.src) {
+				return "", false, l.errorf(start, "unterminated string")
+			}
+			e, ok := unescape[l.src[l.off+1]]
+			if !ok {
+				r, _ := utf8.DecodeRuneInString(l.src[l.off+1:])
+				return "", false, l.errorf(l.off, "unknown escape sequence \\%c", r)
+			}
+			b.WriteByte(e)
+			l.off += 2
+		default:
+			b.WriteByte(c)
+			l.off++
+		}
+	}
+}
+
+var unescape = map[byte]byte{'\\': '\\', '"': '"', '$': '$', 'n': '\n', 't': '\t', 'r': '\r'}
+
+func isDigit(c byte) bool { return c >= '0' && c <= '9' }
+
+func isIdentByte(c byte) bool {
+	return c == '_' || (c >= 'a' && c <= 'z') || (c >= 'A' && c <= 'Z') || isDigit(c)
+}
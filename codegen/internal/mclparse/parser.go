@@ -0,0 +1,548 @@
+package mclparse
+
+import (
+	"fmt"
+	"slices"
+)
+
+// File is a parsed MCL source file.
+type File struct {
+	Stmts []Stmt
+}
+
+// Stmt is a top-level statement. Every statement keeps its verbatim source.
+type Stmt interface {
+	Position() Pos
+	Source() string
+}
+
+// Expr is an expression. Only literals are parsed structurally; everything
+// else (variables, calls, operators, lambdas, ...) is an *Opaque.
+type Expr interface {
+	Source() string
+	exprNode()
+}
+
+type node struct {
+	pos Pos
+	src string
+}
+
+func (n node) Position() Pos  { return n.pos }
+func (n node) Source() string { return n.src }
+func (n *node) set(p *parser, first, last int) {
+	n.pos = position(p.src, p.toks[first].pos)
+	n.src = p.src[p.toks[first].pos:p.toks[last].end]
+}
+
+// Import is `import "path"` with an optional `as name` or `as *`.
+type Import struct {
+	node
+	Path  string
+	Alias string
+}
+
+// Bind is a variable binding `$name = expr`.
+type Bind struct {
+	node
+	Name  string
+	Value Expr
+}
+
+// Resource is a resource block `kind name { key => value, ... }`.
+type Resource struct {
+	node
+	Kind   string
+	Name   Expr
+	Fields []Field
+}
+
+// Field is a `key => value` entry of a resource or struct. Keys of resource
+// metaparams keep their prefix, e.g. "Meta:export".
+type Field struct {
+	Key   string
+	Value Expr
+}
+
+// Other is any statement this parser does not model (if, class, include,
+// func, collect, edges, ...).
+type Other struct {
+	node
+}
+
+// String is a string literal. Interpolated strings contain ${...}.
+type String struct {
+	node
+	Value        string
+	Interpolated bool
+}
+
+// Int is an integer literal; Text keeps the source spelling.
+type Int struct {
+	node
+	Text string
+}
+
+// Float is a float literal; Text keeps the source spelling.
+type Float struct {
+	node
+	Text string
+}
+
+// Bool is a boolean literal.
+type Bool struct {
+	node
+	Value bool
+}
+
+// List is a list literal `[a, b]`.
+type List struct {
+	node
+	Elems []Expr
+}
+
+// Map is a map literal `{k => v}`.
+type Map struct {
+	node
+	Entries []MapEntry
+}
+
+// MapEntry is a single `k => v` entry of a map literal.
+type MapEntry struct {
+	Key   Expr
+	Value Expr
+}
+
+// Struct is a struct literal `struct{name => v}`.
+type Struct struct {
+	node
+	Fields []Field
+}
+
+// Opaque is an expression that is not a literal.
+type Opaque struct {
+	node
+}
+
+func (*String) exprNode() {}
+func (*Int) exprNode()    {}
+func (*Float) exprNode()  {}
+func (*Bool) exprNode()   {}
+func (*List) exprNode()   {}
+func (*Map) exprNode()    {}
+func (*Struct) exprNode() {}
+func (*Opaque) exprNode() {}
+
+// Parse parses MCL source into top-level statements.
+func Parse(src string) (*File, error) {
+	toks, err := lex(src)
+	if err != nil {
+		return nil, err
+	}
+	p := &parser{src: src, toks: toks}
+	f := &File{}
+	for p.peek().kind != tokEOF {
+		s, err := p.parseStmt()
+		if err != nil {
+			return nil, err
+		}
+		f.Stmts = append(f.Stmts, s)
+	}
+	return f, nil
+}
+
+// ParseExpr parses a single expression, which must span all of src.
+func ParseExpr(src string) (Expr, error) {
+	toks, err := lex(src)
+	if err != nil {
+		return nil, err
+	}
+	p := &parser{src: src, toks: toks}
+	e, err := p.parseExpr()
+	if err != nil {
+		return nil, err
+	}
+	if t := p.peek(); t.kind != tokEOF {
+		return nil, p.errorf(t, "unexpected %q after expression", t.text)
+	}
+	return e, nil
+}
+
+type parser struct {
+	src  string
+	toks []token
+	i    int
+}
+
+func (p *parser) peek() token { return p.toks[p.i] }
+func (p *parser) peekAt(n int) token {
+	if p.i+n >= len(p.toks) {
+		return p.toks[len(p.toks)-1]
+	}
+	return p.toks[p.i+n]
+}
+func (p *parser) advance() token {
+	t := p.toks[p.i]
+	if t.kind != tokEOF {
+		p.i++
+	}
+	return t
+}
+
+func (p *parser) is(kind tokKind, text string) bool {
+	t := p.peek()
+	return t.kind == kind && t.text == text
+}
+
+func (p *parser) expect(kind tokKind, text string) (token, error) {
+	t := p.peek()
+	if t.kind != kind || (text != "" && t.text != text) {
+		want := text
+		if want == "" {
+			want = map[tokKind]string{tokIdent: "identifier", tokString: "string"}[kind]
+		}
+		return t, p.errorf(t, "expected %s, found %q", want, p.src[t.pos:t.end])
+	}
+	return p.advance(), nil
+}
+
+func (p *parser) errorf(t token, format string, args ...any) error {
+	return &Error{Pos: position(p.src, t.pos), Msg: fmt.Sprintf(format, args...)}
+}
+
+var keywords = []string{"if", "else", "class", "include", "func", "collect", "import", "for", "forkv", "panic", "true", "false", "struct"}
+
+func (p *parser) parseStmt() (Stmt, error) {
+	start := p.i
+	t := p.peek()
+	switch {
+	case t.kind == tokIdent && t.text == "import":
+		return p.parseImport()
+	case t.kind == tokVar && p.peekAt(1).kind == tokPunct && p.peekAt(1).text == "=":
+		p.advance()
+		p.advance()
+		v, err := p.parseExpr()
+		if err != nil {
+			return nil, err
+		}
+		b := &Bind{Name: t.text, Value: v}
+		b.set(p, start, p.i-1)
+		return b, nil
+	case t.kind == tokIdent && !slices.Contains(keywords, t.text):
+		if r, err := p.parseResource(); err == nil {
+			return r, nil
+		}
+		p.i = start
+	}
+	if err := p.skipStmt(); err != nil {
+		return nil, err
+	}
+	o := &Other{}
+	o.set(p, start, p.i-1)
+	return o, nil
+}
+
+func (p *parser) parseImport() (Stmt, error) {
+	start := p.i
+	p.advance()
+	path, err := p.expect(tokString, "")
+	if err != nil {
+		return nil, err
+	}
+	imp := &Import{Path: path.text}
+	if p.is(tokIdent, "as") {
+		p.advance()
+		if p.is(tokPunct, "*") {
+			imp.Alias = p.advance().text
+		} else {
+			alias, err := p.expect(tokIdent, "")
+			if err != nil {
+				return nil, err
+			}
+			imp.Alias = alias.text
+		}
+	}
+	imp.set(p, start, p.i-1)
+	return imp, nil
+}
+
+func (p *parser) parseResource() (*Resource, error) {
+	start := p.i
+	kind := p.advance().text
+	for p.is(tokPunct, ":") {
+		p.advance()
+		part, err := p.expect(tokIdent, "")
+		if err != nil {
+			return nil, err
+		}
+		kind += ":" + part.text
+	}
+	name, err := p.parseExpr()
+	if err != nil {
+		return nil, err
+	}
+	if _, err := p.expect(tokPunct, "{"); err != nil {
+		return nil, err
+	}
+	fields, err := p.parseFields()
+	if err != nil {
+		return nil, err
+	}
+	r := &Resource{Kind: kind, Name: name, Fields: fields}
+	r.set(p, start, p.i-1)
+	return r, nil
+}
+
+// parseFields parses `key => value,` entries up to and including the closing
+// brace.
+func (p *parser) parseFields() ([]Field, error) {
+	var fields []Field
+	for !p.is(tokPunct, "}") {
+		key, err := p.expect(tokIdent, "")
+		if err != nil {
+			return nil, err
+		}
+		k := key.text
+		if p.is(tokPunct, ":") {
+			p.advance()
+			sub, err := p.expect(tokIdent, "")
+			if err != nil {
+				return nil, err
+			}
+			k += ":" + sub.text
+		}
+		if _, err := p.expect(tokPunct, "=>"); err != nil {
+			return nil, err
+		}
+		v, err := p.parseExpr()
+		if err != nil {
+			return nil, err
+		}
+		fields = append(fields, Field{Key: k, Value: v})
+		if !p.is(tokPunct, "}") {
+			if _, err := p.expect(tokPunct, ","); err != nil {
+				return nil, err
+			}
+		}
+	}
+	p.advance()
+	return fields, nil
+}
+
+// parseExpr parses a literal structurally. Anything else, or a literal that
+// is the operand of an operator, becomes an *Opaque spanning the expression.
+func (p *parser) parseExpr() (Expr, error) {
+	start := p.i
+	e, err := p.parseLiteral()
+	if err == nil && !p.continuesExpr() {
+		return e, nil
+	}
+	p.i = start
+	if err := p.skipExpr(); err != nil {
+		return nil, err
+	}
+	if p.i == start {
+		t := p.peek()
+		return nil, p.errorf(t, "expected expression, found %q", p.src[t.pos:t.end])
+	}
+	o := &Opaque{}
+	o.set(p, start, p.i-1)
+	return o, nil
+}
+
+func (p *parser) parseLiteral() (Expr, error) {
+	start := p.i
+	t := p.peek()
+	switch {
+	case t.kind == tokString:
+		p.advance()
+		s := &String{Value: t.text, Interpolated: t.interpolated}
+		s.set(p, start, start)
+		return s, nil
+	case t.kind == tokInt || t.kind == tokFloat || (t.kind == tokPunct && t.text == "-" && (p.peekAt(1).kind == tokInt || p.peekAt(1).kind == tokFloat) && p.peekAt(1).pos == t.end):
+		if t.text == "-" {
+			p.advance()
+		}
+		n := p.advance()
+		text := p.src[t.pos:n.end]
+		if n.kind == tokFloat {
+			f := &Float{Text: text}
+			f.set(p, start, p.i-1)
+			return f, nil
+		}
+		i := &Int{Text: text}
+		i.set(p, start, p.i-1)
+		return i, nil
+	case t.kind == tokIdent && (t.text == "true" || t.text == "false"):
+		p.advance()
+		b := &Bool{Value: t.text == "true"}
+		b.set(p, start, start)
+		return b, nil
+	case t.kind == tokPunct && t.text == "[":
+		p.advance()
+		l := &List{}
+		for !p.is(tokPunct, "]") {
+			e, err := p.parseExpr()
+			if err != nil {
+				return nil, err
+			}
+			l.Elems = append(l.Elems, e)
+			if !p.is(tokPunct, "]") {
+				if _, err := p.expect(tokPunct, ","); err != nil {
+					return nil, err
+				}
+			}
+		}
+		p.advance()
+		l.set(p, start, p.i-1)
+		return l, nil
+	case t.kind == tokPunct && t.text == "{":
+		p.advance()
+		m := &Map{}
+		for !p.is(tokPunct, "}") {
+			k, err := p.parseExpr()
+			if err != nil {
+				return nil, err
+			}
+			if _, err := p.expect(tokPunct, "=>"); err != nil {
+				return nil, err
+			}
+			v, err := p.parseExpr()
+			if err != nil {
+				return nil, err
+			}
+			m.Entries = append(m.Entries, MapEntry{Key: k, Value: v})
+			if !p.is(tokPunct, "}") {
+				if _, err := p.expect(tokPunct, ","); err != nil {
+					return nil, err
+				}
+			}
+		}
+		p.advance()
+		m.set(p, start, p.i-1)
+		return m, nil
+	case t.kind == tokIdent && t.text == "struct" && p.peekAt(1).kind == tokPunct && p.peekAt(1).text == "{":
+		p.advance()
+		p.advance()
+		fields, err := p.parseFields()
+		if err != nil {
+			return nil, err
+		}
+		s := &Struct{Fields: fields}
+		s.set(p, start, p.i-1)
+		return s, nil
+	}
+	return nil, p.errorf(t, "not a literal")
+}
+
+var binaryOps = []string{"+", "-", "*", "/", "%", "==", "!=", "<", ">", "<=", ">=", "&&", "||", "?:", ".", "(", "["}
+
+// continuesExpr reports whether the next token continues the expression just
+// parsed (an operator, call, field access or index).
+func (p *parser) continuesExpr() bool {
+	t := p.peek()
+	if t.kind == tokPunct {
+		return slices.Contains(binaryOps, t.text)
+	}
+	return t.kind == tokIdent && (t.text == "and" || t.text == "or" || t.text == "in")
+}
+
+// skipExpr skips the tokens of an expression: it stops at a comma, `=>`, a
+// closing bracket it did not open, a `{` that opens a resource body, or at a
+// line break after a complete operand.
+func (p *parser) skipExpr() error {
+	depth := 0
+	start := p.i
+	for {
+		t := p.peek()
+		if t.kind == tokEOF {
+			if depth > 0 {
+				return p.errorf(t, "unexpected end of input")
+			}
+			return nil
+		}
+		if depth == 0 {
+			if t.kind == tokPunct && (t.text == "," || t.text == "=>" || isCloser(t)) {
+				return nil
+			}
+			if p.i > start {
+				prev := p.toks[p.i-1]
+				// `kind $name {` or `collect kind $names {`: the brace opens
+				// the body, unless the expression is a block (func, if) or a
+				// struct literal.
+				if t.kind == tokPunct && t.text == "{" && !isOperator(prev) &&
+					!(prev.kind == tokIdent && prev.text == "struct") && !p.blockExpr(start) {
+					return nil
+				}
+				if t.line > prev.line && !isOperator(prev) && !(t.kind == tokPunct && slices.Contains(binaryOps, t.text)) {
+					return nil
+				}
+			}
+		}
+		if t.kind == tokPunct {
+			switch t.text {
+			case "(", "[", "{":
+				depth++
+			case ")", "]", "}":
+				depth--
+			}
+		}
+		p.advance()
+	}
+}
+
+// blockExpr reports whether the expression starting at token start is a
+// function literal or an if expression, whose braces belong to it.
+func (p *parser) blockExpr(start int) bool {
+	t := p.toks[start]
+	return t.kind == tokIdent && (t.text == "func" || t.text == "if")
+}
+
+func isOperator(t token) bool {
+	if t.kind == tokIdent {
+		return t.text == "and" || t.text == "or" || t.text == "in" || t.text == "not"
+	}
+	return t.kind == tokPunct && t.text != ")" && t.text != "]" && t.text != "}"
+}
+
+func isCloser(t token) bool {
+	return t.kind == tokPunct && (t.text == ")" || t.text == "]" || t.text == "}")
+}
+
+// skipStmt skips a statement this parser does not model. A statement ends
+// after a top-level brace block (unless followed by `else`) or at a line
+// break after a complete operand.
+func (p *parser) skipStmt() error {
+	depth := 0
+	start := p.i
+	for {
+		t := p.peek()
+		if t.kind == tokEOF {
+			if depth > 0 {
+				return p.errorf(t, "unexpected end of input")
+			}
+			return nil
+		}
+		if depth == 0 && p.i > start {
+			prev := p.toks[p.i-1]
+			if prev.kind == tokPunct && prev.text == "}" && !(t.kind == tokIdent && t.text == "else") {
+				return nil
+			}
+			if t.line > prev.line && !isOperator(prev) && !(t.kind == tokPunct && (t.text == "{" || slices.Contains(binaryOps, t.text))) && !(t.kind == tokIdent && t.text == "else") {
+				return nil
+			}
+		}
+		if t.kind == tokPunct {
+			switch t.text {
+			case "(", "[", "{":
+				depth++
+			case ")", "]", "}":
+				depth--
+				if depth < 0 {
+					return p.errorf(t, "unbalanced %q", t.text)
+				}
+			}
+		}
+		p.advance()
+	}
+}
@@ -0,0 +1,65 @@
+package mclparse
+
+import (
+	"fmt"
+	"strconv"
+)
+
+// Value returns the Go value of a literal expression: string, int64, float64,
+// bool, []any, or map[string]any for structs and for maps with string keys.
+// It fails for anything that is not fully static, including interpolated
+// strings.
+func Value(e Expr) (any, error) {
+	switch x := e.(type) {
+	case *String:
+		if x.Interpolated {
+			return nil, fmt.Errorf("string %s uses interpolation", x.Source())
+		}
+		return x.Value, nil
+	case *Int:
+		return strconv.ParseInt(x.Text, 10, 64)
+	case *Float:
+		return strconv.ParseFloat(x.Text, 64)
+	case *Bool:
+		return x.Value, nil
+	case *List:
+		out := make([]any, 0, len(x.Elems))
+		for _, el := range x.Elems {
+			v, err := Value(el)
+			if err != nil {
+				return nil, err
+			}
+			out = append(out, v)
+		}
+		return out, nil
+	case *Struct:
+		out := make(map[string]any, len(x.Fields))
+		for _, f := range x.Fields {
+			v, err := Value(f.Value)
+			if err != nil {
+				return nil, err
+			}
+			out[f.Key] = v
+		}
+		return out, nil
+	case *Map:
+		out := make(map[string]any, len(x.Entries))
+		for _, en := range x.Entries {
+			k, err := Value(en.Key)
+			if err != nil {
+				return nil, err
+			}
+			ks, ok := k.(string)
+			if !ok {
+				return nil, fmt.Errorf("map key %s is not a string", en.Key.Source())
+			}
+			v, err := Value(en.Value)
+			if err != nil {
+				return nil, err
+			}
+			out[ks] = v
+		}
+		return out, nil
+	}
+	return nil, fmt.Errorf("%s is not a literal", e.Source())
+}
@@ -0,0 +1,97 @@
+package nixgen
+
+import (
+	"fmt"
+	"github.com/karpfediem/rx.nix/codegen/internal/parse"
+	"github.com/karpfediem/rx.nix/codegen/internal/util"
+	"strings"
+)
+
+// writeAssertions writes NixOS assertions that check every instance of r
+// against the rules of its Validate() method, so that a resource mgmt would
+// reject fails the build instead.
+func writeAssertions(b *strings.Builder, r parse.ResourceInfo) {
+	fields := make(map[string]parse.FieldInfo, len(r.Fields))
+	for _, f := range r.Fields {
+		fields[f.LangName] = f
+	}
+	attr := util.SanitizeAttrIdent(r.Name)
+	fmt.Fprintf(b, "  config.assertions = lib.concatLists (lib.mapAttrsToList (name: i: [\n")
+	for _, rule := range r.Rules {
+		conds := make([]string, len(rule.When))
+		for i, c := range rule.When {
+			conds[i] = condition(c, fields[c.Field])
+		}
+		fmt.Fprintf(b, "    {\n")
+		fmt.Fprintf(b, "      assertion = !(%s);\n", strings.Join(conds, " && "))
+		fmt.Fprintf(b, "      message = \"rx.res.%s.${name}: \" + %s;\n", attr, util.QuoteNixString(rule.Message))
+		fmt.Fprintf(b, "    }\n")
+	}
+	fmt.Fprintf(b, "  ]) config.rx.res.%s);\n", attr)
+}
+
+// condition renders c as a Nix expression over the instance i.
+func condition(c parse.Condition, f parse.FieldInfo) string {
+	v := effectiveValue(f)
+	switch c.Op {
+	case parse.CondZero:
+		return v + " == " + zeroValue(f)
+	case parse.CondSet:
+		return v + " != " + zeroValue(f)
+	case parse.CondEq:
+		return v + " == " + Literal(c.Value, 0)
+	case parse.CondNe:
+		// Secrets, calls and constants are evaluated on the host, so
+		// they are not checked.
+		return "!builtins.isAttrs " + v + " && " + v + " != " + Literal(c.Value, 0)
+	case parse.CondRelative:
+		// A secret is only known on the host, so it is not checked.
+		return "builtins.isString " + v + " && !(lib.hasPrefix \"/\" " + v + ")"
+	}
+	panic("unknown condition op " + c.Op)
+}
+
+// effectiveValue is the value mgmt sees for f: the instance's, or when it is
+// null, mgmt's default or the zero value of the field's type.
+func effectiveValue(f parse.FieldInfo) string {
+	v := "i." + util.SanitizeAttrIdent(f.LangName)
+	if f.Required {
+		return v
+	}
+	fallback := zeroValue(f)
+	switch {
+	case f.NameDefault:
+		fallback = "name"
+	case f.Default != nil:
+		fallback = Literal(f.Default, 0)
+	}
+	if fallback == "null" {
+		return v
+	}
+	return "(if " + v + " == null then " + fallback + " else " + v + ")"
+}
+
+// zeroValue is the Nix value of the Go zero value of f's type; pointers and
+// unknown types are null.
+func zeroValue(f parse.FieldInfo) string {
+	switch t := f.GoType; {
+	case strings.HasPrefix(t, "*"):
+		return "null"
+	case strings.HasPrefix(t, "[]"):
+		return "[ ]"
+	case strings.HasPrefix(t, "map["):
+		return "{ }"
+	}
+	switch nixPrim(f.GoType) {
+	case "types.bool":
+		return "false"
+	case "types.int":
+		return "0"
+	case "types.float":
+		return "0.0"
+	}
+	if f.GoType == "string" {
+		return `""`
+	}
+	return "null"
+}
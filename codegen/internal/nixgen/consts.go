@@ -0,0 +1,33 @@
+package nixgen
+
+import (
+	"fmt"
+	"github.com/karpfediem/rx.nix/codegen/internal/parse"
+	"github.com/karpfediem/rx.nix/codegen/internal/util"
+	"strings"
+)
+
+// writeConsts writes the rx.const.res option of r, whose values are the IR
+// nodes of mgmt's $const.res constants for r's params, e.g.
+// rx.const.res.file.state.exists.
+func writeConsts(b *strings.Builder, r parse.ResourceInfo) {
+	attr := util.SanitizeAttrIdent(r.Name)
+	fmt.Fprintf(b, "  options.rx.const.res.%s = mkOption {\n", attr)
+	fmt.Fprintf(b, "    type = types.raw;\n")
+	fmt.Fprintf(b, "    readOnly = true;\n")
+	fmt.Fprintf(b, "    description = %s;\n", util.QuoteNixString(fmt.Sprintf(
+		"Values of `rx.res.%s` params that mgmt names as `$const.res.%s.<param>.<name>`, for use in place of the literal values.", attr, r.Name)))
+	fmt.Fprintf(b, "    default = {\n")
+	for i, c := range r.Consts {
+		if i == 0 || r.Consts[i-1].Param != c.Param {
+			fmt.Fprintf(b, "      %s = {\n", util.NixAttrName(c.Param))
+		}
+		node := strings.TrimPrefix(c.Var(r.Name), "const.")
+		fmt.Fprintf(b, "        %s = { __const = { name = %s; type = %s; }; };\n", util.NixAttrName(c.Name), util.QuoteNixString(node), util.QuoteNixString(c.Type))
+		if i == len(r.Consts)-1 || r.Consts[i+1].Param != c.Param {
+			fmt.Fprintf(b, "      };\n")
+		}
+	}
+	fmt.Fprintf(b, "    };\n")
+	fmt.Fprintf(b, "  };\n")
+}
@@ -0,0 +1,256 @@
+package nixgen
+
+import (
+	"fmt"
+	"github.com/karpfediem/rx.nix/codegen/internal/parse"
+	"github.com/karpfediem/rx.nix/codegen/internal/util"
+	"go/ast"
+	"go/doc/comment"
+	"go/parser"
+	"os"
+	"strings"
+	"unicode"
+)
+
+// DocFile returns the name of a resource's Markdown page, next to its
+// res-<name>.nix module.
+func DocFile(r parse.ResourceInfo) string {
+	return pageFile(optionName(r))
+}
+
+// docType is the option type of f as shown to users: the type of its plain
+// values, without the expression and secret references fieldType also takes.
+func docType(f parse.FieldInfo) string {
+	t := nixBaseType(f.GoType)
+	if f.GoType == "string" || f.GoType == "*string" {
+		t = "types.str"
+	}
+	if f.Required {
+		return t
+	}
+	return fmt.Sprintf("types.nullOr (%s)", t)
+}
+
+func pageFile(option string) string {
+	return "res-" + strings.ToLower(strings.TrimPrefix(option, "rx.res.")) + ".md"
+}
+
+// WriteResourceDoc writes a CommonMark reference page for r: its doc, a
+// table of its fields, their full docs, its constants and an example rx.res
+// snippet. Mentions of other resources in refs link to their pages.
+func WriteResourceDoc(path string, r parse.ResourceInfo, refs Refs) error {
+	attr := util.SanitizeAttrIdent(r.Name)
+	var b strings.Builder
+	fmt.Fprintf(&b, "<!-- Auto-generated by codegen. Do not edit. -->\n\n")
+	fmt.Fprintf(&b, "# `rx.res.%s`\n\n", attr)
+	if r.Doc != "" {
+		fmt.Fprintf(&b, "%s\n\n", pageDoc(r.Doc, refs, r.StructName))
+	}
+	fmt.Fprintf(&b, "mgmt resource kind `%s`, implemented by `%s`.\n\n", r.Name, r.StructName)
+
+	fmt.Fprintf(&b, "## Fields\n\n")
+	if len(r.Fields) == 0 {
+		fmt.Fprintf(&b, "This resource has no settable fields.\n\n")
+	} else {
+		fmt.Fprintf(&b, "| Option | Nix type | MCL type | Go type | Default | Description |\n")
+		fmt.Fprintf(&b, "| --- | --- | --- | --- | --- | --- |\n")
+		for _, f := range r.Fields {
+			def := "`null`"
+			switch {
+			case f.NameDefault:
+				def = "`name`"
+			case f.Required:
+				def = "required"
+			case f.Default != nil:
+				def += " (mgmt: " + codeCell(strings.Join(strings.Fields(Literal(f.Default, 0)), " ")) + ")"
+			}
+			goType := codeCell(f.GoType)
+			if f.DeclType != "" {
+				goType += " (declared " + codeCell(f.DeclType) + ")"
+			}
+			fmt.Fprintf(&b, "| `%s` | %s | %s | %s | %s | %s |\n",
+				util.NixAttrName(f.LangName),
+				codeCell(docType(f)),
+				codeCell(mclTypeForGo(f.GoType)),
+				goType,
+				def,
+				tableCell(pageDoc(firstSentence(f.Doc), refs, r.StructName)))
+		}
+		for _, f := range r.Fields {
+			if f.NameDefault {
+				fmt.Fprintf(&b, "\nA default of `name` is the instance's attribute name, as in `rx.res.%s.<name>`, which is also the mgmt resource name.\n", attr)
+				break
+			}
+		}
+		for _, f := range r.Fields {
+			if f.Required {
+				fmt.Fprintf(&b, "\nFields marked required have no default: mgmt rejects the resource without them.\n")
+				break
+			}
+		}
+		fmt.Fprintf(&b, "\nEvery field also accepts an `rx.lib.fn` call or an `rx.const` constant of its MCL type, and string fields a `__secret` reference, all evaluated on the host.\n")
+		fmt.Fprintf(&b, "\nUnset (`null`) fields are left out of the generated MCL, so mgmt's own default, shown in parentheses where known, applies.\n\n")
+
+		for _, f := range r.Fields {
+			// Docs longer than their synopsis in the table get a section.
+			if firstSentence(f.Doc) != strings.Join(strings.Fields(f.Doc), " ") {
+				fmt.Fprintf(&b, "### `%s`\n\n%s\n\n", util.NixAttrName(f.LangName), pageDoc(f.Doc, refs, r.StructName))
+			}
+		}
+	}
+
+	if len(r.Consts) > 0 {
+		fmt.Fprintf(&b, "## Constants\n\n")
+		fmt.Fprintf(&b, "Values mgmt names for params of this resource, to use instead of the literal value.\n\n")
+		fmt.Fprintf(&b, "| Nix | MCL | Value |\n")
+		fmt.Fprintf(&b, "| --- | --- | --- |\n")
+		for _, c := range r.Consts {
+			value := "unknown"
+			if c.Value != nil {
+				value = codeCell(Literal(c.Value, 0))
+			}
+			fmt.Fprintf(&b, "| `rx.const.res.%s.%s.%s` | `$%s` | %s |\n", attr, util.NixAttrName(c.Param), util.NixAttrName(c.Name), c.Var(r.Name), value)
+		}
+		fmt.Fprintf(&b, "\n")
+	}
+
+	fmt.Fprintf(&b, "## Example\n\n")
+	if ex := r.Example; ex != nil {
+		if ex.Source == parse.DocCommentSource {
+			fmt.Fprintf(&b, "From the `%s` doc comment:\n\n", r.StructName)
+		} else {
+			fmt.Fprintf(&b, "From mgmt's `%s`:\n\n", ex.Source)
+		}
+		fmt.Fprintf(&b, "```nix\n")
+		fmt.Fprintf(&b, "rx.res.%s.%s = %s;\n", attr, util.QuoteNixString(ex.Name), Literal(ex.Params, 0))
+		fmt.Fprintf(&b, "```\n")
+	} else {
+		fmt.Fprintf(&b, "```nix\n")
+		fmt.Fprintf(&b, "rx.res.%s.\"example\" = {\n", attr)
+		for _, f := range r.Fields {
+			fmt.Fprintf(&b, "  %s = %s;\n", util.NixAttrName(f.LangName), exampleForGo(f.GoType))
+		}
+		fmt.Fprintf(&b, "};\n")
+		fmt.Fprintf(&b, "```\n")
+	}
+
+	return os.WriteFile(path, []byte(b.String()), 0o644)
+}
+
+// WriteDocIndex writes the Markdown index linking every resource page.
+func WriteDocIndex(path string, resources []parse.ResourceInfo) error {
+	refs := NewRefs(resources)
+	var b strings.Builder
+	fmt.Fprintf(&b, "<!-- Auto-generated by codegen. Do not edit. -->\n\n")
+	fmt.Fprintf(&b, "# mgmt resources\n\n")
+	fmt.Fprintf(&b, "Options under `rx.res`, one page per mgmt resource kind.\n\n")
+	fmt.Fprintf(&b, "| Option | Description |\n")
+	fmt.Fprintf(&b, "| --- | --- |\n")
+	for _, r := range resources {
+		fmt.Fprintf(&b, "| [`rx.res.%s`](%s) | %s |\n", util.SanitizeAttrIdent(r.Name), DocFile(r), tableCell(pageDoc(firstSentence(r.Doc), refs, r.StructName)))
+	}
+	return os.WriteFile(path, []byte(b.String()), 0o644)
+}
+
+// mclTypeForGo returns the MCL type mgmt derives from a Go field type, or ""
+// when it depends on a named type the parser can't see into.
+func mclTypeForGo(goType string) string {
+	e, err := parser.ParseExpr(goType)
+	if err != nil {
+		return ""
+	}
+	return mclType(e)
+}
+
+func mclType(e ast.Expr) string {
+	switch x := e.(type) {
+	case *ast.StarExpr:
+		return mclType(x.X)
+	case *ast.ParenExpr:
+		return mclType(x.X)
+	case *ast.ArrayType:
+		if elem := mclType(x.Elt); elem != "" {
+			return "[]" + elem
+		}
+	case *ast.MapType:
+		k, v := mclType(x.Key), mclType(x.Value)
+		if k != "" && v != "" {
+			return "map{" + k + ": " + v + "}"
+		}
+	case *ast.Ident:
+		switch x.Name {
+		case "string":
+			return "str"
+		case "bool":
+			return "bool"
+		case "int", "int8", "int16", "int32", "int64",
+			"uint", "uint8", "uint16", "uint32", "uint64":
+			return "int"
+		case "float32", "float64":
+			return "float"
+		}
+	}
+	return ""
+}
+
+// exampleForGo returns a placeholder Nix value accepted by the option type
+// nixBaseType gives goType.
+func exampleForGo(goType string) string {
+	switch {
+	case strings.HasPrefix(goType, "[]"):
+		return "[ " + examplePrim(strings.TrimPrefix(goType, "[]")) + " ]"
+	case strings.HasPrefix(goType, "map["):
+		return "{ name = \"value\"; }"
+	default:
+		return examplePrim(goType)
+	}
+}
+
+func examplePrim(goType string) string {
+	switch nixPrim(goType) {
+	case "types.bool":
+		return "false"
+	case "types.int":
+		return "0"
+	case "types.float":
+		return "0.0"
+	default:
+		return "\"value\""
+	}
+}
+
+func codeCell(s string) string {
+	if s == "" {
+		return ""
+	}
+	return strings.ReplaceAll(codeSpan(s), "|", `\|`)
+}
+
+// tableCell flattens Markdown text onto one line of a table cell.
+func tableCell(md string) string {
+	return strings.ReplaceAll(strings.Join(strings.Fields(md), " "), "|", `\|`)
+}
+
+// firstSentence returns the first sentence of doc's first paragraph, as
+// go/doc does for package synopses, except that a period only ends the
+// sentence before an upper-case letter, so "e.g. " does not.
+func firstSentence(doc string) string {
+	d := parse.ParseDoc(doc, nil)
+	if len(d.Content) == 0 {
+		return ""
+	}
+	if _, ok := d.Content[0].(*comment.Paragraph); !ok {
+		return ""
+	}
+	var pr comment.Printer
+	text := strings.Fields(string(pr.Text(&comment.Doc{Content: d.Content[:1]})))
+	if len(text) == 0 {
+		return ""
+	}
+	for i, w := range text[:len(text)-1] {
+		if next := text[i+1]; strings.HasSuffix(w, ".") && unicode.IsUpper([]rune(next)[0]) {
+			return strings.Join(text[:i+1], " ")
+		}
+	}
+	return strings.Join(text, " ")
+}
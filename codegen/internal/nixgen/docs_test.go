@@ -0,0 +1,50 @@
+package nixgen
+
+import (
+	"github.com/karpfediem/rx.nix/codegen/internal/parse"
+	"github.com/karpfediem/rx.nix/codegen/internal/testutil"
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+func TestWriteResourceDocGolden(t *testing.T) {
+	resources, _, err := parse.ParseResources(testutil.MgmtFixture, parse.Options{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	dir := t.TempDir()
+	check := func(t *testing.T, name string, write func(string) error) {
+		fn := filepath.Join(dir, name)
+		if err := write(fn); err != nil {
+			t.Fatal(err)
+		}
+		got, err := os.ReadFile(fn)
+		if err != nil {
+			t.Fatal(err)
+		}
+		testutil.Golden(t, filepath.Join("testdata", "docs", name+".golden"), got)
+	}
+	for _, r := range resources {
+		t.Run(r.Name, func(t *testing.T) {
+			check(t, DocFile(r), func(fn string) error { return WriteResourceDoc(fn, r, NewRefs(resources)) })
+		})
+	}
+	check(t, "README.md", func(fn string) error { return WriteDocIndex(fn, resources) })
+}
+
+func TestMCLTypeForGo(t *testing.T) {
+	for goType, want := range map[string]string{
+		"*string":             "str",
+		"[][]string":          "[][]str",
+		"map[string][]string": "map{str: []str}",
+		"uint16":              "int",
+		"*float64":            "float",
+		"time.Duration":       "",
+		"[]interface{}":       "",
+	} {
+		if got := mclTypeForGo(goType); got != want {
+			t.Errorf("mclTypeForGo(%q) = %q, want %q", goType, got, want)
+		}
+	}
+}
@@ -9,11 +9,27 @@ import (
 	"strings"
 )
 
-func WriteResourceNix(path string, r parse.ResourceInfo) error {
+// WriteResourceNix writes the rx.res option module of r. Descriptions are
+// Markdown, with mentions of the other resources in refs as {option} links.
+func WriteResourceNix(path string, r parse.ResourceInfo, refs Refs) error {
 	var b strings.Builder
 	fmt.Fprintf(&b, "# Auto-generated by codegen. Do not edit.\n")
-	fmt.Fprintf(&b, "{ lib, ... }:\n")
-	fmt.Fprintf(&b, "let\n  inherit (lib) mkOption types;\n")
+	if len(r.Rules) > 0 {
+		fmt.Fprintf(&b, "{ lib, config, ... }:\n")
+	} else {
+		fmt.Fprintf(&b, "{ lib, ... }:\n")
+	}
+	fmt.Fprintf(&b, "let\n  inherit (lib) mkOption types literalExpression literalMD;\n")
+	fmt.Fprintf(&b, "  # { __secret = { provider = \"file\"; path = ...; }; } is read on the host at apply time;\n")
+	fmt.Fprintf(&b, "  # age and sops secrets (file = ./secret.age) ship encrypted in the deploy.\n")
+	fmt.Fprintf(&b, "  secretRef = types.submodule {\n")
+	fmt.Fprintf(&b, "    options.__secret = mkOption { type = types.attrsOf (types.either types.str types.path); };\n")
+	fmt.Fprintf(&b, "  };\n")
+	fmt.Fprintf(&b, "  # rx.lib.fn calls and rx.const constants are evaluated on the host; t is\n")
+	fmt.Fprintf(&b, "  # the MCL type of the param.\n")
+	fmt.Fprintf(&b, "  mclExpr = t: types.addCheck (types.attrsOf types.anything)\n")
+	fmt.Fprintf(&b, "    (v: let e = v.__call or v.__const or null; in e != null && (t == \"\" || e.type == t || lib.hasInfix \"?\" e.type))\n")
+	fmt.Fprintf(&b, "    // { description = \"mgmt function call or constant\"; };\n")
 	fmt.Fprintf(&b, "in\n{\n")
 	fmt.Fprintf(&b, "  options.rx.res.%s = mkOption {\n", util.SanitizeAttrIdent(r.Name))
 
@@ -21,20 +37,41 @@ func WriteResourceNix(path string, r parse.ResourceInfo) error {
 	if desc == "" {
 		desc = fmt.Sprintf("mgmt resource: %s (struct %s).", r.Name, r.StructName)
 	}
-	fmt.Fprintf(&b, "    description = ''\n%s\n'';\n", util.EscapeIndentedNix(desc))
+	fmt.Fprintf(&b, "    description = ''\n%s\n'';\n", util.EscapeIndentedNix(optionDoc(desc, refs, r.StructName)))
+	if ex := r.Example; ex != nil {
+		// literalExpression keeps the example as written in the manual.
+		example := Literal(map[string]any{ex.Name: ex.Params}, 0)
+		fmt.Fprintf(&b, "    example = literalExpression ''\n%s\n'';\n", util.EscapeIndentedNix(example))
+	}
 	fmt.Fprintf(&b, "    type = types.attrsOf (types.submodule ({ name, ... }: {\n")
 	fmt.Fprintf(&b, "      options = {\n")
 
 	for _, f := range r.Fields {
-		nixType := nixTypeForGo(f.GoType) // always nullable
 		fmt.Fprintf(&b, "        %s = mkOption {\n", util.SanitizeAttrIdent(f.LangName))
-		fmt.Fprintf(&b, "          type = %s;\n", nixType)
+		fmt.Fprintf(&b, "          type = %s;\n", fieldType(f))
 		if f.Doc != "" {
-			fmt.Fprintf(&b, "          description = ''\n%s\n'';\n", util.EscapeIndentedNix(f.Doc))
+			fmt.Fprintf(&b, "          description = ''\n%s\n'';\n", util.EscapeIndentedNix(optionDoc(f.Doc, refs, r.StructName)))
 		} else {
 			fmt.Fprintf(&b, "          description = \"\";\n")
 		}
-		fmt.Fprintf(&b, "          default = null;\n") // safe to read everywhere
+		if f.Example != nil {
+			fmt.Fprintf(&b, "          example = %s;\n", Literal(f.Example, 5))
+		}
+		// Without a default, leaving a required param out fails evaluation
+		// rather than the deploy.
+		switch {
+		case f.NameDefault:
+			// mgmt falls back to the resource name; say so in Nix too, so
+			// that reading the option gives what mgmt uses.
+			fmt.Fprintf(&b, "          default = name;\n")
+			fmt.Fprintf(&b, "          defaultText = literalExpression \"name\";\n")
+		case !f.Required:
+			fmt.Fprintf(&b, "          default = null;\n") // safe to read everywhere
+		}
+		if f.Default != nil && !f.NameDefault {
+			// null still means "not set"; show what mgmt does then.
+			fmt.Fprintf(&b, "          defaultText = literalMD %s;\n", util.QuoteNixString(defaultMD(f.Default)))
+		}
 		fmt.Fprintf(&b, "        };\n")
 	}
 
@@ -42,11 +79,38 @@ func WriteResourceNix(path string, r parse.ResourceInfo) error {
 	fmt.Fprintf(&b, "    }));\n")
 	fmt.Fprintf(&b, "    default = {};\n")
 	fmt.Fprintf(&b, "  };\n")
+	if len(r.Consts) > 0 {
+		writeConsts(&b, r)
+	}
+	if len(r.Rules) > 0 {
+		writeAssertions(&b, r)
+	}
 	fmt.Fprintf(&b, "}\n")
 
 	return os.WriteFile(path, []byte(b.String()), 0o644)
 }
 
+// defaultMD describes a param left null that mgmt's Default() sets to v.
+func defaultMD(v any) string {
+	lit := Literal(v, 0)
+	if strings.Contains(lit, "\n") {
+		return "Unset (`null`); mgmt uses\n\n```nix\n" + lit + "\n```"
+	}
+	return "Unset (`null`); mgmt uses " + codeSpan(lit) + "."
+}
+
+// codeSpan returns s as a Markdown code span.
+func codeSpan(s string) string {
+	fence := "`"
+	for strings.Contains(s, fence) {
+		fence += "`"
+	}
+	if strings.HasPrefix(s, "`") || strings.HasSuffix(s, "`") {
+		s = " " + s + " "
+	}
+	return fence + s + fence
+}
+
 func WriteDefaultNix(path string, files []string) error {
 	sort.Strings(files)
 	var b strings.Builder
@@ -64,19 +128,31 @@ func WriteDefaultNix(path string, files []string) error {
 	return os.WriteFile(path, []byte(b.String()), 0o644)
 }
 
-func nixTypeForGo(goType string) string {
-	base := func() string {
-		switch {
-		case strings.HasPrefix(goType, "[]"):
-			inner := strings.TrimPrefix(goType, "[]")
-			return fmt.Sprintf("types.listOf %s", nixPrim(inner))
-		case strings.HasPrefix(goType, "map["):
-			return "types.attrsOf types.str" // coarse but acceptable
-		default:
-			return nixPrim(goType)
-		}
-	}()
-	return fmt.Sprintf("types.nullOr (%s)", base)
+// fieldType returns the option type of f: nullable, with null meaning "not
+// set", unless mgmt requires the param. Calls and constants of the param's
+// MCL type are accepted too; they come first, so that secretRef doesn't take
+// them.
+func fieldType(f parse.FieldInfo) string {
+	t := fmt.Sprintf("types.either (mclExpr %s) (%s)", util.QuoteNixString(mclTypeForGo(f.GoType)), nixBaseType(f.GoType))
+	if f.Required {
+		return t
+	}
+	return fmt.Sprintf("types.nullOr (%s)", t)
+}
+
+func nixBaseType(goType string) string {
+	switch {
+	case strings.HasPrefix(goType, "[]"):
+		inner := strings.TrimPrefix(goType, "[]")
+		return fmt.Sprintf("types.listOf %s", nixPrim(inner))
+	case strings.HasPrefix(goType, "map["):
+		return "types.attrsOf types.str" // coarse but acceptable
+	case goType == "string" || goType == "*string":
+		// string params may also be filled from a secret at runtime
+		return "types.either types.str secretRef"
+	default:
+		return nixPrim(goType)
+	}
 }
 
 func nixPrim(goType string) string {
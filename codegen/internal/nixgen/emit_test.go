@@ -0,0 +1,49 @@
+package nixgen
+
+import (
+	"github.com/karpfediem/rx.nix/codegen/internal/parse"
+	"github.com/karpfediem/rx.nix/codegen/internal/testutil"
+	"github.com/karpfediem/rx.nix/codegen/internal/util"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+func TestWriteResourceNixGolden(t *testing.T) {
+	resources, _, err := parse.ParseResources(testutil.MgmtFixture, parse.Options{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	dir := t.TempDir()
+	for _, r := range resources {
+		name := "res-" + util.SanitizeAttrIdent(strings.ToLower(r.Name)) + ".nix"
+		t.Run(r.Name, func(t *testing.T) {
+			fn := filepath.Join(dir, name)
+			if err := WriteResourceNix(fn, r, NewRefs(resources)); err != nil {
+				t.Fatal(err)
+			}
+			got, err := os.ReadFile(fn)
+			if err != nil {
+				t.Fatal(err)
+			}
+			testutil.Golden(t, filepath.Join("testdata", name+".golden"), got)
+		})
+	}
+}
+
+func TestWriteFuncNixGolden(t *testing.T) {
+	funcs, _, err := parse.ParseFunctions(testutil.MgmtFixture, parse.Options{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	fn := filepath.Join(t.TempDir(), FuncNixFile)
+	if err := WriteFuncNix(fn, funcs); err != nil {
+		t.Fatal(err)
+	}
+	got, err := os.ReadFile(fn)
+	if err != nil {
+		t.Fatal(err)
+	}
+	testutil.Golden(t, filepath.Join("testdata", FuncNixFile+".golden"), got)
+}
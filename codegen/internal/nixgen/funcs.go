@@ -0,0 +1,133 @@
+package nixgen
+
+import (
+	"fmt"
+	"github.com/karpfediem/rx.nix/codegen/internal/parse"
+	"github.com/karpfediem/rx.nix/codegen/internal/util"
+	"os"
+	"sort"
+	"strings"
+)
+
+// FuncNixFile is the name cmd/nixos gives the module of WriteFuncNix.
+const FuncNixFile = "fn.nix"
+
+// fnTree is a module of rx.lib.fn: its functions and sub-modules by name.
+type fnTree map[string]any // *parse.FuncInfo or fnTree
+
+// WriteFuncNix writes the rx.lib.fn option, whose functions build the IR
+// nodes of calls of funcs, such as rx.lib.fn.datetime.now [ ], checking the
+// arguments against the signatures when evaluated.
+func WriteFuncNix(path string, funcs []parse.FuncInfo) error {
+	root := make(fnTree)
+	for i, f := range funcs {
+		t := root
+		var parts []string
+		if f.Module != "" {
+			parts = strings.Split(f.Module, "/")
+		}
+		for _, p := range parts {
+			sub, ok := t[p].(fnTree)
+			if !ok {
+				if _, clash := t[p]; clash {
+					return fmt.Errorf("module %s: %s is also a function", f.Module, p)
+				}
+				sub = make(fnTree)
+				t[p] = sub
+			}
+			t = sub
+		}
+		if _, clash := t[f.Name]; clash {
+			return fmt.Errorf("function %s: %s is also a module", f.Path(), f.Name)
+		}
+		t[f.Name] = &funcs[i]
+	}
+
+	var b strings.Builder
+	fmt.Fprintf(&b, "# Auto-generated by codegen. Do not edit.\n")
+	fmt.Fprintf(&b, "{ lib, ... }:\n")
+	fmt.Fprintf(&b, "let\n  inherit (lib) mkOption types;\n")
+	fmt.Fprintf(&b, "  # Secrets, calls and constants are evaluated on the host, so they pass any\n")
+	fmt.Fprintf(&b, "  # check.\n")
+	fmt.Fprintf(&b, "  isNode = v: builtins.isAttrs v && (v ? __call || v ? __const || v ? __secret);\n")
+	fmt.Fprintf(&b, "  any = _: true;\n")
+	fmt.Fprintf(&b, "  listOf = check: v: builtins.isList v && builtins.all (el: isNode el || check el) v;\n")
+	fmt.Fprintf(&b, "  # call gives the IR node of a call of the function at path, once args\n")
+	fmt.Fprintf(&b, "  # match the params of its signature sig.\n")
+	fmt.Fprintf(&b, "  call = path: module: name: sig: result: params: args:\n")
+	fmt.Fprintf(&b, "    let\n")
+	fmt.Fprintf(&b, "      where = \"rx.lib.fn.${path}\";\n")
+	fmt.Fprintf(&b, "      n = builtins.length args;\n")
+	fmt.Fprintf(&b, "      bad = lib.findFirst (i: !(isNode (builtins.elemAt args i) || (builtins.elemAt params i).check (builtins.elemAt args i))) null (lib.range 0 (n - 1));\n")
+	fmt.Fprintf(&b, "    in\n")
+	fmt.Fprintf(&b, "    if !builtins.isList args then throw \"${where}: takes a list of arguments, as in ${where} [ ]\"\n")
+	fmt.Fprintf(&b, "    else if n != builtins.length params then throw \"${where}: ${sig} takes ${toString (builtins.length params)} argument(s), got ${toString n}\"\n")
+	fmt.Fprintf(&b, "    else if bad != null then throw \"${where}: argument ${toString (bad + 1)} must be ${(builtins.elemAt params bad).type}, got ${builtins.typeOf (builtins.elemAt args bad)}\"\n")
+	fmt.Fprintf(&b, "    else { __call = { inherit module name args; type = result; }; };\n")
+	fmt.Fprintf(&b, "in\n{\n")
+	fmt.Fprintf(&b, "  options.rx.lib.fn = mkOption {\n")
+	fmt.Fprintf(&b, "    type = types.raw;\n")
+	fmt.Fprintf(&b, "    readOnly = true;\n")
+	fmt.Fprintf(&b, "    description = ''\n%s\n'';\n", util.EscapeIndentedNix(
+		"Functions of the mgmt language, by module, e.g. `rx.lib.fn.golang.strings.to_upper [ \"hi\" ]`. "+
+			"Each takes its arguments as a list and returns a call that mgmt evaluates on the host, "+
+			"which resource params of the matching type accept."))
+	fmt.Fprintf(&b, "    default = ")
+	writeFnTree(&b, root, 2)
+	fmt.Fprintf(&b, ";\n")
+	fmt.Fprintf(&b, "  };\n")
+	fmt.Fprintf(&b, "}\n")
+	return os.WriteFile(path, []byte(b.String()), 0o644)
+}
+
+func writeFnTree(b *strings.Builder, t fnTree, level int) {
+	indent := strings.Repeat("  ", level+1)
+	names := make([]string, 0, len(t))
+	for name := range t {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	b.WriteString("{\n")
+	for _, name := range names {
+		switch x := t[name].(type) {
+		case fnTree:
+			fmt.Fprintf(b, "%s%s = ", indent, util.NixAttrName(name))
+			writeFnTree(b, x, level+1)
+			b.WriteString(";\n")
+		case *parse.FuncInfo:
+			if x.Doc != "" {
+				for _, l := range strings.Split(x.Doc, "\n") {
+					fmt.Fprintf(b, "%s%s\n", indent, strings.TrimRight("# "+l, " "))
+				}
+			}
+			params := "["
+			for _, p := range x.Params {
+				params += fmt.Sprintf(" { type = %s; check = %s; }", util.QuoteNixString(p.Type), mclCheck(p.Type))
+			}
+			fmt.Fprintf(b, "%s%s = call %s %s %s %s %s %s ];\n", indent, util.NixAttrName(name),
+				util.QuoteNixString(x.Path()), util.QuoteNixString(x.Module), util.QuoteNixString(x.Name),
+				util.QuoteNixString(x.Sig), util.QuoteNixString(x.Result), params)
+		}
+	}
+	fmt.Fprintf(b, "%s}", strings.Repeat("  ", level))
+}
+
+// mclCheck returns a Nix predicate for values of the MCL type t; types it
+// can't check, such as type variables, accept anything.
+func mclCheck(t string) string {
+	switch {
+	case t == "str":
+		return "builtins.isString"
+	case t == "int":
+		return "builtins.isInt"
+	case t == "float":
+		return "builtins.isFloat"
+	case t == "bool":
+		return "builtins.isBool"
+	case strings.HasPrefix(t, "[]"):
+		return "(listOf " + mclCheck(strings.TrimPrefix(t, "[]")) + ")"
+	case strings.HasPrefix(t, "map{"), strings.HasPrefix(t, "struct{"):
+		return "builtins.isAttrs"
+	}
+	return "any"
+}
@@ -0,0 +1,84 @@
+package nixgen
+
+import (
+	"encoding/json"
+	"fmt"
+	"github.com/karpfediem/rx.nix/codegen/internal/util"
+	"sort"
+	"strconv"
+	"strings"
+)
+
+// Literal renders a JSON-like Go value (as produced by encoding/json or
+// mclparse.Value) as a Nix expression. Nested attrsets and lists are laid out
+// one element per line, indented relative to indentLevel.
+func Literal(v any, indentLevel int) string {
+	switch x := v.(type) {
+	case nil:
+		return "null"
+	case string:
+		return util.QuoteNixString(x)
+	case bool:
+		if x {
+			return "true"
+		}
+		return "false"
+	case int, int8, int16, int32, int64, uint, uint8, uint16, uint32, uint64:
+		return fmt.Sprintf("%d", x)
+	case float32:
+		return nixFloat(float64(x))
+	case float64:
+		return nixFloat(x)
+	case json.Number:
+		if _, err := x.Int64(); err == nil {
+			return x.String()
+		}
+		if f, err := x.Float64(); err == nil {
+			return nixFloat(f)
+		}
+		return util.QuoteNixString(x.String())
+	case []any:
+		if len(x) == 0 {
+			return "[ ]"
+		}
+		inner := strings.Repeat("  ", indentLevel+1)
+		var b strings.Builder
+		b.WriteString("[\n")
+		for _, el := range x {
+			s := Literal(el, indentLevel+1)
+			if strings.HasPrefix(s, "-") {
+				s = "(" + s + ")" // a leading minus would be parsed as subtraction
+			}
+			b.WriteString(inner + s + "\n")
+		}
+		b.WriteString(strings.Repeat("  ", indentLevel) + "]")
+		return b.String()
+	case map[string]any:
+		if len(x) == 0 {
+			return "{ }"
+		}
+		keys := make([]string, 0, len(x))
+		for k := range x {
+			keys = append(keys, k)
+		}
+		sort.Strings(keys)
+		inner := strings.Repeat("  ", indentLevel+1)
+		var b strings.Builder
+		b.WriteString("{\n")
+		for _, k := range keys {
+			fmt.Fprintf(&b, "%s%s = %s;\n", inner, util.NixAttrName(k), Literal(x[k], indentLevel+1))
+		}
+		b.WriteString(strings.Repeat("  ", indentLevel) + "}")
+		return b.String()
+	}
+	return util.QuoteNixString(fmt.Sprintf("%v", v))
+}
+
+// nixFloat formats f so that Nix parses it back as a float.
+func nixFloat(f float64) string {
+	s := strconv.FormatFloat(f, 'f', -1, 64)
+	if !strings.Contains(s, ".") {
+		s += ".0"
+	}
+	return s
+}
@@ -0,0 +1,190 @@
+package nixgen
+
+import (
+	"github.com/karpfediem/rx.nix/codegen/internal/parse"
+	"github.com/karpfediem/rx.nix/codegen/internal/util"
+	"go/doc/comment"
+	"strings"
+)
+
+// Refs maps the Go struct implementing each resource to its rx.res option
+// name, e.g. "FileRes" -> "rx.res.file", for cross-references in docs.
+type Refs map[string]string
+
+// NewRefs returns the cross-reference targets of resources.
+func NewRefs(resources []parse.ResourceInfo) Refs {
+	refs := make(Refs, len(resources))
+	for _, r := range resources {
+		refs[r.StructName] = optionName(r)
+	}
+	return refs
+}
+
+func optionName(r parse.ResourceInfo) string {
+	return "rx.res." + util.SanitizeAttrIdent(r.Name)
+}
+
+func (refs Refs) structs() map[string]bool {
+	out := make(map[string]bool, len(refs))
+	for name := range refs {
+		out[name] = true
+	}
+	return out
+}
+
+// markdown renders a parsed Go doc comment as Markdown.
+type markdown struct {
+	b strings.Builder
+	// link renders a reference to the resource implemented by the named
+	// struct, or returns "" to leave the name as code.
+	link func(structName string) string
+}
+
+// optionDoc renders doc for an option description. Other resources are
+// referenced with the NixOS manual's {option} role.
+func optionDoc(doc string, refs Refs, self string) string {
+	return renderMarkdown(doc, refs, func(name string) string {
+		switch {
+		case name == self:
+			return name
+		case refs[name] == "":
+			return ""
+		}
+		return "{option}`" + refs[name] + "`"
+	})
+}
+
+// pageDoc renders doc for a reference page, linking other resources' pages.
+func pageDoc(doc string, refs Refs, self string) string {
+	return renderMarkdown(doc, refs, func(name string) string {
+		switch {
+		case name == self:
+			return name
+		case refs[name] == "":
+			return ""
+		}
+		return "[`" + refs[name] + "`](" + pageFile(refs[name]) + ")"
+	})
+}
+
+func renderMarkdown(text string, refs Refs, link func(string) string) string {
+	m := &markdown{link: link}
+	m.blocks(parse.ParseDoc(text, refs.structs()).Content)
+	return strings.TrimRight(m.b.String(), "\n")
+}
+
+func (m *markdown) blocks(blocks []comment.Block) {
+	for i, b := range blocks {
+		if i > 0 {
+			m.b.WriteString("\n")
+		}
+		switch x := b.(type) {
+		case *comment.Paragraph:
+			m.text(x.Text)
+			m.b.WriteString("\n")
+		case *comment.Heading:
+			m.b.WriteString("**")
+			m.text(x.Text)
+			m.b.WriteString("**\n")
+		case *comment.Code:
+			// A longer fence than any backtick run in the code keeps it intact.
+			fence := "```"
+			for strings.Contains(x.Text, fence) {
+				fence += "`"
+			}
+			m.b.WriteString(fence + "\n" + x.Text + fence + "\n")
+		case *comment.List:
+			for j, item := range x.Items {
+				if j > 0 && x.BlankBetween() {
+					m.b.WriteString("\n")
+				}
+				marker := "- "
+				if item.Number != "" {
+					marker = item.Number + ". "
+				}
+				m.b.WriteString(marker)
+				for k, c := range item.Content {
+					if p, ok := c.(*comment.Paragraph); ok {
+						if k > 0 {
+							m.b.WriteString("\n\n" + strings.Repeat(" ", len(marker)))
+						}
+						m.listText(p.Text, len(marker))
+					}
+				}
+				m.b.WriteString("\n")
+			}
+		}
+	}
+}
+
+// listText writes the text of a list item, indenting continuation lines.
+func (m *markdown) listText(text []comment.Text, indent int) {
+	sub := &markdown{link: m.link}
+	sub.text(text)
+	m.b.WriteString(strings.ReplaceAll(sub.b.String(), "\n", "\n"+strings.Repeat(" ", indent)))
+}
+
+func (m *markdown) text(text []comment.Text) {
+	for _, t := range text {
+		switch x := t.(type) {
+		case comment.Plain:
+			m.b.WriteString(escapeMarkdown(string(x)))
+		case comment.Italic:
+			m.b.WriteString("*" + escapeMarkdown(string(x)) + "*")
+		case *comment.Link:
+			if len(x.Text) == 1 && x.Text[0] == comment.Plain(x.URL) {
+				m.b.WriteString("<" + x.URL + ">")
+				continue
+			}
+			m.b.WriteString("[")
+			m.text(x.Text)
+			m.b.WriteString("](" + x.URL + ")")
+		case *comment.DocLink:
+			if x.ImportPath == "" && x.Recv == "" {
+				if ref := m.link(x.Name); ref != "" {
+					m.b.WriteString(ref)
+					continue
+				}
+			}
+			var name strings.Builder
+			for _, t := range x.Text {
+				if p, ok := t.(comment.Plain); ok {
+					name.WriteString(string(p))
+				}
+			}
+			m.b.WriteString("`" + name.String() + "`")
+		}
+	}
+}
+
+// escapeMarkdown escapes the characters that would otherwise start Markdown
+// markup, including block markup at the start of a line.
+func escapeMarkdown(s string) string {
+	var b strings.Builder
+	lineStart := true
+	for i := 0; i < len(s); i++ {
+		c := s[i]
+		switch {
+		case strings.IndexByte("\\`*_[]<", c) >= 0:
+			b.WriteByte('\\')
+		case lineStart && strings.IndexByte("#>+-", c) >= 0:
+			b.WriteByte('\\')
+		case lineStart && c >= '0' && c <= '9':
+			// "1. " or "1) " would start an ordered list.
+			j := i
+			for j < len(s) && s[j] >= '0' && s[j] <= '9' {
+				j++
+			}
+			if j < len(s) && (s[j] == '.' || s[j] == ')') {
+				b.WriteString(s[i:j])
+				b.WriteByte('\\')
+				i = j - 1
+				lineStart = false
+				continue
+			}
+		}
+		b.WriteByte(c)
+		lineStart = c == '\n' || (lineStart && c == ' ')
+	}
+	return b.String()
+}
@@ -0,0 +1,40 @@
+package nixgen
+
+import (
+	"testing"
+)
+
+func TestOptionDoc(t *testing.T) {
+	refs := Refs{"FileRes": "rx.res.file", "SvcRes": "rx.res.svc"}
+	for _, tc := range []struct {
+		doc, want string
+	}{
+		{"Manages a [FileRes] or a SvcRes, not a FileResource.",
+			"Manages a {option}`rx.res.file` or a SvcRes, not a FileResource."},
+		{"Pairs with a FileRes (see FileRes_x and MyFileRes).",
+			"Pairs with a {option}`rx.res.file` (see FileRes\\_x and MyFileRes)."},
+		{"Uses [fmt.Sprintf] and [Missing].", "Uses `fmt.Sprintf` and \\[Missing\\]."},
+		{"Escapes *stars*, `ticks`, a_b and <tags>.", "Escapes \\*stars\\*, \\`ticks\\`, a\\_b and \\<tags>."},
+		{"Example\n\n\tx := \"```\"\n", "Example\n\n````\nx := \"```\"\n````"},
+		{"Values:\n  - one\n  - two\n\n1. is not a list here", "Values:\n\n- one\n- two\n\n1\\. is not a list here"},
+		{"# Heading\n\nText.", "**Heading**\n\nText."},
+		{"See https://example.com/x.", "See <https://example.com/x>."},
+	} {
+		if got := optionDoc(tc.doc, refs, "SvcRes"); got != tc.want {
+			t.Errorf("optionDoc(%q) =\n%s\nwant\n%s", tc.doc, got, tc.want)
+		}
+	}
+}
+
+func TestFirstSentence(t *testing.T) {
+	for doc, want := range map[string]string{
+		"Mode is a mode, e.g. \"0640\". It is octal.": "Mode is a mode, e.g. \"0640\".",
+		"State is one of:\n  - exists\n  - absent":    "State is one of:",
+		"Intro.\n\n\tcode\n":                          "Intro.",
+		"":                                            "",
+	} {
+		if got := firstSentence(doc); got != want {
+			t.Errorf("firstSentence(%q) = %q, want %q", doc, got, want)
+		}
+	}
+}
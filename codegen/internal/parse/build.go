@@ -0,0 +1,49 @@
+package parse
+
+import (
+	"go/build"
+	"os"
+	"strings"
+)
+
+// Options selects the variant of the mgmt source to parse, to match the
+// mgmt binary that is deployed.
+type Options struct {
+	GOOS   string   // default $GOOS, else "linux"
+	GOARCH string   // default $GOARCH, else "amd64"
+	Tags   []string // build tags, e.g. "novirt" or "nodocker"
+
+	// TypeCheck resolves field types with go/types, so that named types,
+	// aliases and generic instances map to the option type of what they
+	// stand for. Packages are type-checked from source rather than loaded
+	// with go/packages; imports outside the mgmt tree and its vendor
+	// directory are found by the go command run in the mgmt tree, so they
+	// must be in its module cache.
+	TypeCheck bool
+}
+
+// buildContext returns the context whose MatchFile decides which files are
+// part of the build: it evaluates //go:build lines (with go/build/constraint)
+// and _GOOS/_GOARCH file name suffixes against the options.
+func (o Options) buildContext() *build.Context {
+	ctx := build.Default
+	ctx.GOOS = firstNonEmpty(o.GOOS, os.Getenv("GOOS"), "linux")
+	ctx.GOARCH = firstNonEmpty(o.GOARCH, os.Getenv("GOARCH"), "amd64")
+	ctx.BuildTags = o.Tags
+	return &ctx
+}
+
+// SplitTags splits a -tags flag value like the go command does: by commas,
+// or by spaces in the older form.
+func SplitTags(s string) []string {
+	return strings.FieldsFunc(s, func(r rune) bool { return r == ',' || r == ' ' })
+}
+
+func firstNonEmpty(ss ...string) string {
+	for _, s := range ss {
+		if s != "" {
+			return s
+		}
+	}
+	return ""
+}
@@ -0,0 +1,230 @@
+package parse
+
+import (
+	"fmt"
+	"go/ast"
+	"go/token"
+	"regexp"
+	"sort"
+	"strconv"
+	"strings"
+)
+
+// ResourceConst is a value of a resource param that mgmt names as
+// $const.res.<kind>.<param>.<name>, such as $const.res.file.state.exists.
+type ResourceConst struct {
+	Param string // lang name of the param, e.g. "state"
+	Name  string // e.g. "exists"
+	Type  string // MCL type of the value, e.g. "str"
+	Value any    `json:",omitempty"` // nil if not a literal
+}
+
+// Var returns the name of the variable holding c for resources of kind, e.g.
+// "const.res.file.state.exists".
+func (c ResourceConst) Var(kind string) string {
+	return "const.res." + kind + "." + c.Param + "." + c.Name
+}
+
+// valueTypes maps the types of mgmt's values to their MCL types.
+var valueTypes = map[string]string{
+	"StrValue":   "str",
+	"IntValue":   "int",
+	"FloatValue": "float",
+	"BoolValue":  "bool",
+}
+
+// constRegistration is a constant of a RegisterResourceParams call.
+type constRegistration struct {
+	pos     token.Pos
+	kind    string
+	c       ResourceConst
+	problem *issue // why the constant could not be resolved
+}
+
+// collectResourceConsts finds the constants pkg registers with
+// vars.RegisterResourceParams, under any import name. Each must be a
+// function returning a &types.XValue{V: ...} literal.
+func collectResourceConsts(pkg *parsedPkg, localConsts, engineConsts map[string]string) []constRegistration {
+	var out []constRegistration
+	for _, f := range pkg.files {
+		imports := pkg.importAlias[f]
+		isPkg := func(e ast.Expr, suffix string) bool {
+			id, ok := e.(*ast.Ident)
+			return ok && strings.HasSuffix(imports[id.Name], suffix)
+		}
+		isEngine := func(e ast.Expr) bool { return isPkg(e, "/engine") }
+		str := func(e ast.Expr) (string, bool) {
+			return constString(e, isEngine, localConsts, engineConsts)
+		}
+		ast.Inspect(f, func(n ast.Node) bool {
+			call, ok := n.(*ast.CallExpr)
+			if !ok {
+				return true
+			}
+			sel, ok := call.Fun.(*ast.SelectorExpr)
+			if !ok || sel.Sel.Name != "RegisterResourceParams" || !isPkg(sel.X, "/lang/funcs/vars") {
+				return true
+			}
+			fail := func(pos token.Pos, format string, args ...any) {
+				out = append(out, constRegistration{pos: pos, problem: &issue{pos: pos, reason: ReasonUnresolvedConst, message: fmt.Sprintf(format, args...)}})
+			}
+			if len(call.Args) != 2 {
+				fail(call.Pos(), "RegisterResourceParams called with %d arguments", len(call.Args))
+				return true
+			}
+			kind, ok := str(call.Args[0])
+			if !ok {
+				fail(call.Pos(), "kind %s is not a known string constant", exprToString(call.Args[0]))
+				return true
+			}
+			params, ok := call.Args[1].(*ast.CompositeLit)
+			if !ok {
+				fail(call.Pos(), "kind %q: params %s are not a map literal", kind, exprToString(call.Args[1]))
+				return true
+			}
+			for _, el := range params.Elts {
+				pkv, ok := el.(*ast.KeyValueExpr)
+				if !ok {
+					continue
+				}
+				param, ok := str(pkv.Key)
+				values, isLit := pkv.Value.(*ast.CompositeLit)
+				if !ok || !isLit {
+					fail(pkv.Pos(), "kind %q: param %s is not a constant with a map literal of values", kind, exprToString(pkv.Key))
+					continue
+				}
+				for _, vel := range values.Elts {
+					vkv, ok := vel.(*ast.KeyValueExpr)
+					if !ok {
+						continue
+					}
+					c := ResourceConst{Param: strings.ToLower(param)}
+					if c.Name, ok = str(vkv.Key); !ok {
+						fail(vkv.Pos(), "kind %q: param %s: name %s is not a known string constant", kind, param, exprToString(vkv.Key))
+						continue
+					}
+					if c.Type, c.Value, ok = constValue(vkv.Value, str); !ok {
+						fail(vkv.Pos(), "%s: value is not a function returning a &types.XValue{...} literal", c.Var(kind))
+						continue
+					}
+					out = append(out, constRegistration{pos: vkv.Pos(), kind: kind, c: c})
+				}
+			}
+			return true
+		})
+	}
+	return out
+}
+
+// constString evaluates a string constant of the package, or one of the
+// engine package reached through a selector.
+func constString(e ast.Expr, isEngine func(ast.Expr) bool, localConsts, engineConsts map[string]string) (string, bool) {
+	if sel, ok := e.(*ast.SelectorExpr); ok {
+		if !isEngine(sel.X) {
+			return "", false
+		}
+		s, ok := engineConsts[sel.Sel.Name]
+		return s, ok
+	}
+	return stringValue(e, localConsts)
+}
+
+// constValue returns the MCL type and, if it is a literal, the value that a
+// func() interfaces.Var { return &types.XValue{V: ...} } returns.
+func constValue(e ast.Expr, str func(ast.Expr) (string, bool)) (typ string, value any, ok bool) {
+	fn, ok := e.(*ast.FuncLit)
+	if !ok || len(fn.Body.List) != 1 {
+		return "", nil, false
+	}
+	ret, ok := fn.Body.List[0].(*ast.ReturnStmt)
+	if !ok || len(ret.Results) != 1 {
+		return "", nil, false
+	}
+	ue, ok := ret.Results[0].(*ast.UnaryExpr)
+	if !ok || ue.Op != token.AND {
+		return "", nil, false
+	}
+	cl, ok := ue.X.(*ast.CompositeLit)
+	if !ok {
+		return "", nil, false
+	}
+	sel, ok := cl.Type.(*ast.SelectorExpr)
+	if !ok {
+		return "", nil, false
+	}
+	if typ, ok = valueTypes[sel.Sel.Name]; !ok {
+		return "", nil, false
+	}
+	for _, el := range cl.Elts {
+		kv, ok := el.(*ast.KeyValueExpr)
+		if !ok {
+			continue
+		}
+		if key, ok := kv.Key.(*ast.Ident); !ok || key.Name != "V" {
+			continue
+		}
+		switch typ {
+		case "str":
+			if s, ok := str(kv.Value); ok {
+				value = s
+			}
+		case "bool":
+			if id, ok := kv.Value.(*ast.Ident); ok && (id.Name == "true" || id.Name == "false") {
+				value = id.Name == "true"
+			}
+		default:
+			if bl, ok := kv.Value.(*ast.BasicLit); ok && (bl.Kind == token.INT || bl.Kind == token.FLOAT) {
+				if typ == "int" {
+					value, _ = strconv.ParseInt(bl.Value, 0, 64)
+				} else {
+					value, _ = strconv.ParseFloat(bl.Value, 64)
+				}
+			}
+		}
+	}
+	return typ, value, true
+}
+
+// constIdent matches the parts of a constant's name that MCL can spell in a
+// $const.res variable; kinds like docker:container can't be.
+var constIdent = regexp.MustCompile(`^[a-z]([a-z0-9_]*[a-z0-9])?$`)
+
+// addConsts gives the resources their constants, leaving out those of
+// unknown kinds or params, or that MCL can't name, as diagnostics.
+func addConsts(resources []ResourceInfo, regs []constRegistration, report func(issue)) {
+	byKind := make(map[string]*ResourceInfo, len(resources))
+	for i := range resources {
+		byKind[resources[i].Name] = &resources[i]
+	}
+	for _, reg := range regs {
+		r := byKind[reg.kind]
+		switch {
+		case !constIdent.MatchString(reg.kind) || !constIdent.MatchString(reg.c.Param) || !constIdent.MatchString(reg.c.Name):
+			report(issue{reg.pos, ReasonUnresolvedConst, fmt.Sprintf("%s: not a dotted MCL identifier, so it can't be named", reg.c.Var(reg.kind))})
+		case r == nil:
+			report(issue{reg.pos, ReasonUnresolvedConst, fmt.Sprintf("%s: no resource of kind %q", reg.c.Var(reg.kind), reg.kind)})
+		case !hasField(*r, reg.c.Param):
+			report(issue{reg.pos, ReasonUnresolvedConst, fmt.Sprintf("%s: %s has no param %s", reg.c.Var(reg.kind), reg.kind, reg.c.Param)})
+		default:
+			r.Consts = append(r.Consts, reg.c)
+		}
+	}
+	for i := range resources {
+		cs := resources[i].Consts
+		sort.Slice(cs, func(a, b int) bool {
+			if cs[a].Param != cs[b].Param {
+				return cs[a].Param < cs[b].Param
+			}
+			return cs[a].Name < cs[b].Name
+		})
+	}
+}
+
+func hasField(r ResourceInfo, lang string) bool {
+	for _, f := range r.Fields {
+		if f.LangName == lang {
+			return true
+		}
+	}
+	return false
+}
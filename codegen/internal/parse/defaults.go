@@ -0,0 +1,169 @@
+package parse
+
+import (
+	"encoding/json"
+	"go/ast"
+	"go/parser"
+	"go/token"
+	"strconv"
+	"strings"
+)
+
+// collectDefaults reads the Default() methods of the resource structs and
+// returns struct name -> Go field name -> default, for the fields set to a
+// value that can be evaluated statically. Numbers are json.Number, as in
+// examples.
+func collectDefaults(pkg *parsedPkg, localConsts, engineConsts map[string]string) map[string]map[string]any {
+	out := make(map[string]map[string]any)
+	for _, f := range pkg.files {
+		ev := constEval{imports: pkg.importAlias[f], local: localConsts, engine: engineConsts}
+		for _, decl := range f.Decls {
+			fd, ok := decl.(*ast.FuncDecl)
+			if !ok || fd.Name.Name != "Default" || fd.Recv == nil || len(fd.Recv.List) != 1 || fd.Body == nil {
+				continue
+			}
+			recv := fd.Recv.List[0].Type
+			if star, ok := recv.(*ast.StarExpr); ok {
+				recv = star.X
+			}
+			id, ok := recv.(*ast.Ident)
+			if !ok {
+				continue
+			}
+			cl := returnedLiteral(fd.Body, id.Name)
+			if cl == nil {
+				continue
+			}
+			defaults := make(map[string]any)
+			for _, el := range cl.Elts {
+				kv, ok := el.(*ast.KeyValueExpr)
+				if !ok {
+					continue
+				}
+				key, ok := kv.Key.(*ast.Ident)
+				if !ok {
+					continue
+				}
+				if v, ok := ev.eval(kv.Value); ok {
+					defaults[key.Name] = v
+				}
+			}
+			if len(defaults) > 0 {
+				out[id.Name] = defaults
+			}
+		}
+	}
+	return out
+}
+
+// fieldDefault returns v if it is a value of goType.
+func fieldDefault(v any, goType string) any {
+	if v == nil {
+		return nil
+	}
+	t, err := parser.ParseExpr(goType)
+	if err != nil || !fits(v, t) {
+		return nil
+	}
+	return v
+}
+
+// returnedLiteral returns the composite literal of type name that body
+// returns, as in `return &FileRes{...}`.
+func returnedLiteral(body *ast.BlockStmt, name string) *ast.CompositeLit {
+	for _, stmt := range body.List {
+		ret, ok := stmt.(*ast.ReturnStmt)
+		if !ok || len(ret.Results) != 1 {
+			continue
+		}
+		e := ret.Results[0]
+		if ue, ok := e.(*ast.UnaryExpr); ok && ue.Op == token.AND {
+			e = ue.X
+		}
+		if cl, ok := e.(*ast.CompositeLit); ok {
+			if id, ok := cl.Type.(*ast.Ident); ok && id.Name == name {
+				return cl
+			}
+		}
+	}
+	return nil
+}
+
+// constEval evaluates literals, string constants and composite literals of
+// those; anything else (calls, arithmetic, pointers, ...) is not static.
+type constEval struct {
+	imports       map[string]string // local name -> import path
+	local, engine map[string]string // string constants
+}
+
+func (ev constEval) eval(e ast.Expr) (any, bool) {
+	switch x := e.(type) {
+	case *ast.ParenExpr:
+		return ev.eval(x.X)
+	case *ast.BasicLit:
+		switch x.Kind {
+		case token.STRING:
+			s, err := strconv.Unquote(x.Value)
+			return s, err == nil
+		case token.INT:
+			n, err := strconv.ParseInt(strings.ReplaceAll(x.Value, "_", ""), 0, 64)
+			return json.Number(strconv.FormatInt(n, 10)), err == nil
+		case token.FLOAT:
+			f, err := strconv.ParseFloat(strings.ReplaceAll(x.Value, "_", ""), 64)
+			return jsonNumbers(f), err == nil
+		}
+	case *ast.UnaryExpr:
+		if x.Op != token.SUB {
+			return nil, false
+		}
+		v, ok := ev.eval(x.X)
+		if n, isNum := v.(json.Number); ok && isNum {
+			return json.Number("-" + string(n)), true
+		}
+	case *ast.Ident:
+		switch x.Name {
+		case "true", "false":
+			return x.Name == "true", true
+		}
+		s, ok := ev.local[x.Name]
+		return s, ok
+	case *ast.SelectorExpr:
+		if pkg, ok := x.X.(*ast.Ident); ok && strings.HasSuffix(ev.imports[pkg.Name], "/engine") {
+			s, ok := ev.engine[x.Sel.Name]
+			return s, ok
+		}
+	case *ast.CompositeLit:
+		switch x.Type.(type) {
+		case *ast.ArrayType:
+			l := make([]any, 0, len(x.Elts))
+			for _, el := range x.Elts {
+				v, ok := ev.eval(el)
+				if !ok {
+					return nil, false
+				}
+				l = append(l, v)
+			}
+			return l, true
+		case *ast.MapType:
+			m := make(map[string]any, len(x.Elts))
+			for _, el := range x.Elts {
+				kv, ok := el.(*ast.KeyValueExpr)
+				if !ok {
+					return nil, false
+				}
+				k, ok := ev.eval(kv.Key)
+				ks, isStr := k.(string)
+				if !ok || !isStr {
+					return nil, false
+				}
+				v, ok := ev.eval(kv.Value)
+				if !ok {
+					return nil, false
+				}
+				m[ks] = v
+			}
+			return m, true
+		}
+	}
+	return nil, false
+}
@@ -0,0 +1,111 @@
+package parse
+
+import (
+	"bytes"
+	"fmt"
+	"go/token"
+	"io/fs"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+)
+
+// Diagnostic is a place in the mgmt source the parser could not make sense
+// of, so that what it declares is missing from the resources or their
+// options are coarser than mgmt's types.
+type Diagnostic struct {
+	File    string // relative to the mgmt root, slash-separated
+	Line    int
+	Column  int
+	Reason  string // one of the Reason* constants
+	Message string
+}
+
+// Diagnostic reasons.
+const (
+	ReasonSyntax          = "syntax error"           // the file is skipped
+	ReasonUnresolvedKind  = "unresolved kind"        // the registration is skipped
+	ReasonUnresolvedCtor  = "unresolved constructor" // the registration is skipped
+	ReasonStructNotFound  = "struct not found"       // the registration is skipped
+	ReasonDuplicateKind   = "duplicate kind"         // the later registration is skipped
+	ReasonUntaggedField   = "untagged field"         // the field has no option
+	ReasonUnsupportedType = "unsupported type"       // the option is a plain string
+	ReasonTypeError       = "type error"             // with Options.TypeCheck; types it affects stay as written
+	ReasonUnresolvedFunc  = "unresolved function"    // the function registration is skipped
+	ReasonUnresolvedSig   = "unresolved signature"   // the function registration is skipped
+	ReasonDuplicateFunc   = "duplicate function"     // the later registration is skipped
+	ReasonUnresolvedConst = "unresolved constant"    // the $const.res constant is skipped
+)
+
+func (d Diagnostic) String() string {
+	return fmt.Sprintf("%s:%d:%d: %s: %s", d.File, d.Line, d.Column, d.Reason, d.Message)
+}
+
+// issue is a problem found while scanning a package, which becomes a
+// Diagnostic if it concerns a resource.
+type issue struct {
+	pos     token.Pos
+	reason  string
+	message string
+}
+
+func (is issue) diagnostic(fset *token.FileSet, mgmtRoot string) Diagnostic {
+	return diagnosticAt(mgmtRoot, fset.Position(is.pos), is.reason, is.message)
+}
+
+func diagnosticAt(mgmtRoot string, p token.Position, reason, message string) Diagnostic {
+	file := p.Filename
+	if rel, err := filepath.Rel(mgmtRoot, file); err == nil {
+		file = rel
+	}
+	return Diagnostic{File: filepath.ToSlash(file), Line: p.Line, Column: p.Column, Reason: reason, Message: message}
+}
+
+// resourceDirs returns the package directories that may register resources:
+// resDir and everything below it, and any other directory under mgmtRoot
+// with a Go file calling RegisterResource, except engDir, which defines it.
+// Hidden, vendor and testdata directories are skipped.
+func resourceDirs(mgmtRoot, resDir, engDir string) ([]string, error) {
+	dirs := make(map[string]bool)
+	err := filepath.WalkDir(mgmtRoot, func(path string, d fs.DirEntry, err error) error {
+		if err != nil {
+			return err
+		}
+		name := d.Name()
+		if d.IsDir() {
+			if path != mgmtRoot && (strings.HasPrefix(name, ".") || strings.HasPrefix(name, "_") || name == "vendor" || name == "testdata") {
+				return filepath.SkipDir
+			}
+			return nil
+		}
+		if !strings.HasSuffix(name, ".go") || strings.HasSuffix(name, "_test.go") {
+			return nil
+		}
+		dir := filepath.Dir(path)
+		if dirs[dir] || dir == engDir {
+			return nil
+		}
+		if dir == resDir || strings.HasPrefix(dir, resDir+string(filepath.Separator)) {
+			dirs[dir] = true
+			return nil
+		}
+		src, err := os.ReadFile(path)
+		if err != nil {
+			return err
+		}
+		dirs[dir] = bytes.Contains(src, []byte("RegisterResource("))
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+	var out []string
+	for dir, ok := range dirs {
+		if ok {
+			out = append(out, dir)
+		}
+	}
+	sort.Strings(out)
+	return out, nil
+}
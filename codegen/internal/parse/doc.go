@@ -0,0 +1,70 @@
+package parse
+
+import (
+	"go/doc/comment"
+	"regexp"
+	"sort"
+	"strings"
+)
+
+// ParseDoc parses the text of a doc comment with go/doc/comment. Mentions of
+// the struct names in structs, bracketed as [FileRes] or not, become doc
+// links, so that renderers can cross-reference the resources they implement.
+func ParseDoc(text string, structs map[string]bool) *comment.Doc {
+	p := comment.Parser{
+		LookupSym: func(recv, name string) bool { return recv == "" && structs[name] },
+	}
+	doc := p.Parse(text)
+	if len(structs) == 0 {
+		return doc
+	}
+	names := make([]string, 0, len(structs))
+	for name := range structs {
+		names = append(names, regexp.QuoteMeta(name))
+	}
+	sort.Strings(names)
+	mention := regexp.MustCompile(`\b(?:` + strings.Join(names, "|") + `)\b`)
+	for _, b := range doc.Content {
+		switch x := b.(type) {
+		case *comment.Paragraph:
+			x.Text = linkMentions(x.Text, mention)
+		case *comment.Heading:
+			x.Text = linkMentions(x.Text, mention)
+		case *comment.List:
+			for _, item := range x.Items {
+				for _, c := range item.Content {
+					if p, ok := c.(*comment.Paragraph); ok {
+						p.Text = linkMentions(p.Text, mention)
+					}
+				}
+			}
+		}
+	}
+	return doc
+}
+
+// linkMentions splits plain text at mentions of a struct name into doc links.
+func linkMentions(text []comment.Text, mention *regexp.Regexp) []comment.Text {
+	var out []comment.Text
+	for _, t := range text {
+		plain, ok := t.(comment.Plain)
+		if !ok {
+			out = append(out, t)
+			continue
+		}
+		s := string(plain)
+		last := 0
+		for _, loc := range mention.FindAllStringIndex(s, -1) {
+			if loc[0] > last {
+				out = append(out, comment.Plain(s[last:loc[0]]))
+			}
+			name := s[loc[0]:loc[1]]
+			out = append(out, &comment.DocLink{Text: []comment.Text{comment.Plain(name)}, Name: name})
+			last = loc[1]
+		}
+		if last < len(s) {
+			out = append(out, comment.Plain(s[last:]))
+		}
+	}
+	return out
+}
@@ -0,0 +1,296 @@
+package parse
+
+import (
+	"encoding/json"
+	"github.com/karpfediem/rx.nix/codegen/internal/mclparse"
+	"go/ast"
+	"go/parser"
+	"os"
+	"path/filepath"
+	"regexp"
+	"sort"
+	"strconv"
+	"strings"
+)
+
+// ResourceExample is a resource block from mgmt's docs or examples, reduced
+// to the params whose values are literals of the field's type.
+type ResourceExample struct {
+	Name   string         // the resource's name
+	Params map[string]any // lang name -> value; numbers are json.Number
+	Source string         // e.g. "examples/lang/file0.mcl", or DocCommentSource
+}
+
+// DocCommentSource is the Source of examples taken from the struct's doc.
+const DocCommentSource = "doc comment"
+
+// ExamplesDir is where mgmt keeps its MCL examples, relative to its root.
+var ExamplesDir = filepath.Join("examples", "lang")
+
+// exampleMarker introduces an inline example in a field doc.
+var exampleMarker = regexp.MustCompile(`(?i)\b(?:e\.g\.|for example|example:)[,:]?\s*`)
+
+// addExamples sets resource and field examples. Examples in doc comments
+// win over those in mgmtRoot's examples/lang/*.mcl, which are read in file
+// name order: the resource example is the doc comment block with the most
+// usable params, or the examples/lang block with the most if the doc has
+// none, and a field without a value there takes the first it has elsewhere.
+func addExamples(mgmtRoot string, resources []ResourceInfo, docBlocks map[string][]string) {
+	type candidate struct {
+		res    *mclparse.Resource
+		source string
+	}
+	byKind := make(map[string][]candidate)
+	add := func(src, source string) {
+		f, err := mclparse.Parse(src)
+		if err != nil {
+			return
+		}
+		for _, s := range f.Stmts {
+			if r, ok := s.(*mclparse.Resource); ok {
+				byKind[r.Kind] = append(byKind[r.Kind], candidate{r, source})
+			}
+		}
+	}
+	for _, r := range resources {
+		for _, b := range docBlocks[r.Name] {
+			add(b, DocCommentSource)
+		}
+	}
+	files, _ := filepath.Glob(filepath.Join(mgmtRoot, ExamplesDir, "*.mcl"))
+	sort.Strings(files)
+	for _, fn := range files {
+		src, err := os.ReadFile(fn)
+		if err != nil {
+			continue
+		}
+		rel, _ := filepath.Rel(mgmtRoot, fn)
+		add(string(src), filepath.ToSlash(rel))
+	}
+
+	for i := range resources {
+		r := &resources[i]
+		var all []*ResourceExample
+		for _, c := range byKind[r.Name] {
+			if ex := resourceExample(c.res, c.source, r.Fields); ex != nil {
+				all = append(all, ex)
+				if r.Example == nil || betterExample(ex, r.Example) {
+					r.Example = ex
+				}
+			}
+		}
+		if r.Example != nil {
+			all = append([]*ResourceExample{r.Example}, all...)
+		}
+		for j := range r.Fields {
+			f := &r.Fields[j]
+			for _, ex := range all {
+				if f.Example != nil {
+					break
+				}
+				f.Example = ex.Params[f.LangName]
+			}
+		}
+	}
+}
+
+// betterExample reports whether ex is a better resource example than cur: it
+// is from a doc comment and cur is not, or from the same kind of source with
+// more params.
+func betterExample(ex, cur *ResourceExample) bool {
+	fromDoc, curFromDoc := ex.Source == DocCommentSource, cur.Source == DocCommentSource
+	if fromDoc != curFromDoc {
+		return fromDoc
+	}
+	return len(ex.Params) > len(cur.Params)
+}
+
+func resourceExample(r *mclparse.Resource, source string, fields []FieldInfo) *ResourceExample {
+	name, ok := r.Name.(*mclparse.String)
+	if !ok || name.Interpolated {
+		return nil
+	}
+	types := make(map[string]string, len(fields))
+	for _, f := range fields {
+		types[f.LangName] = f.GoType
+	}
+	params := make(map[string]any)
+	for _, f := range r.Fields {
+		goType, ok := types[f.Key]
+		if !ok {
+			continue
+		}
+		if v, ok := literalOf(f.Value, goType); ok {
+			params[f.Key] = v
+		}
+	}
+	if len(params) == 0 {
+		return nil
+	}
+	return &ResourceExample{Name: name.Value, Params: params, Source: source}
+}
+
+// codeBlocks returns the indented code blocks of a doc comment.
+func codeBlocks(groups ...*ast.CommentGroup) []string {
+	var blocks []string
+	for _, g := range groups {
+		var cur []string
+		flush := func() {
+			if len(cur) > 0 {
+				blocks = append(blocks, strings.Join(cur, "\n"))
+				cur = nil
+			}
+		}
+		for _, line := range strings.Split(g.Text(), "\n") {
+			switch {
+			case strings.HasPrefix(line, "\t") || strings.HasPrefix(line, " "):
+				cur = append(cur, line)
+			case line == "" && len(cur) > 0:
+				cur = append(cur, line)
+			default:
+				flush()
+			}
+		}
+		flush()
+	}
+	return blocks
+}
+
+// fieldExample finds an example value for a field of goType in its doc: a
+// code block holding a literal, or a literal following "e.g." or "for
+// example".
+func fieldExample(goType string, groups ...*ast.CommentGroup) any {
+	for _, b := range codeBlocks(groups...) {
+		if e, err := mclparse.ParseExpr(b); err == nil {
+			if v, ok := literalOf(e, goType); ok {
+				return v
+			}
+		}
+	}
+	doc := docText(groups...)
+	for _, loc := range exampleMarker.FindAllStringIndex(doc, -1) {
+		rest := doc[loc[1]:]
+		if v, ok := leadingLiteral(rest, goType); ok {
+			return v
+		}
+	}
+	return nil
+}
+
+// leadingLiteral parses the longest prefix of s that is an MCL literal of
+// goType. A literal in backticks is taken as a whole.
+func leadingLiteral(s, goType string) (any, bool) {
+	if code, ok := strings.CutPrefix(s, "`"); ok {
+		if i := strings.IndexByte(code, '`'); i >= 0 {
+			if e, err := mclparse.ParseExpr(code[:i]); err == nil {
+				return literalOf(e, goType)
+			}
+		}
+		return nil, false
+	}
+	if i := strings.IndexByte(s, '\n'); i >= 0 {
+		s = s[:i]
+	}
+	for end := len(s); end > 0; end-- {
+		if e, err := mclparse.ParseExpr(s[:end]); err == nil {
+			if v, ok := literalOf(e, goType); ok {
+				return v, true
+			}
+		}
+	}
+	return nil, false
+}
+
+// literalOf returns the value of e if it is a literal that fits goType, with
+// numbers as json.Number so that the value survives the manifest.
+func literalOf(e mclparse.Expr, goType string) (any, bool) {
+	v, err := mclparse.Value(e)
+	if err != nil {
+		return nil, false
+	}
+	t, err := parser.ParseExpr(goType)
+	if err != nil {
+		return nil, false
+	}
+	v = jsonNumbers(v)
+	return v, fits(v, t)
+}
+
+func jsonNumbers(v any) any {
+	switch x := v.(type) {
+	case int64:
+		return json.Number(strconv.FormatInt(x, 10))
+	case float64:
+		s := strconv.FormatFloat(x, 'f', -1, 64)
+		if !strings.Contains(s, ".") {
+			s += ".0"
+		}
+		return json.Number(s)
+	case []any:
+		for i, el := range x {
+			x[i] = jsonNumbers(el)
+		}
+	case map[string]any:
+		for k, el := range x {
+			x[k] = jsonNumbers(el)
+		}
+	}
+	return v
+}
+
+// fits reports whether v is a value of the Go type t. Named types other than
+// the builtin ones never fit, as their underlying type is unknown here.
+func fits(v any, t ast.Expr) bool {
+	switch x := t.(type) {
+	case *ast.StarExpr:
+		return fits(v, x.X)
+	case *ast.ParenExpr:
+		return fits(v, x.X)
+	case *ast.ArrayType:
+		l, ok := v.([]any)
+		if !ok {
+			return false
+		}
+		for _, el := range l {
+			if !fits(el, x.Elt) {
+				return false
+			}
+		}
+		return true
+	case *ast.MapType:
+		m, ok := v.(map[string]any)
+		if !ok {
+			return false
+		}
+		if k, ok := x.Key.(*ast.Ident); !ok || k.Name != "string" {
+			return false
+		}
+		for _, el := range m {
+			if !fits(el, x.Value) {
+				return false
+			}
+		}
+		return true
+	case *ast.Ident:
+		switch x.Name {
+		case "string":
+			_, ok := v.(string)
+			return ok
+		case "bool":
+			_, ok := v.(bool)
+			return ok
+		case "int", "int8", "int16", "int32", "int64",
+			"uint", "uint8", "uint16", "uint32", "uint64":
+			n, ok := v.(json.Number)
+			if !ok {
+				return false
+			}
+			_, err := n.Int64()
+			return err == nil && !(strings.HasPrefix(x.Name, "uint") && strings.HasPrefix(string(n), "-"))
+		case "float32", "float64":
+			_, ok := v.(json.Number)
+			return ok
+		}
+	}
+	return false
+}
@@ -0,0 +1,407 @@
+package parse
+
+import (
+	"errors"
+	"fmt"
+	"go/ast"
+	"go/token"
+	"io/fs"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+)
+
+// FuncInfo is a function mgmt registers for the language, such as
+// datetime.now.
+type FuncInfo struct {
+	Module string // e.g. "golang/strings"; empty for core functions like len
+	Name   string // e.g. "to_upper"
+	Sig    string // MCL signature, e.g. "func(s str) str"
+	Params []FuncParam
+	Result string // MCL type
+	Doc    string
+}
+
+// FuncParam is a parameter of a function signature. Types are MCL types;
+// ?1, ?2, ... stand for any type.
+type FuncParam struct {
+	Name string `json:",omitempty"` // empty if the signature leaves it out
+	Type string
+}
+
+// Path is the function's name qualified by its module, e.g.
+// "golang/strings.to_upper".
+func (f FuncInfo) Path() string {
+	if f.Module == "" {
+		return f.Name
+	}
+	return f.Module + "." + f.Name
+}
+
+// registryPkgs are the import path suffixes of the packages whose Register
+// and ModuleRegister add language functions.
+var registryPkgs = []string{"/lang/funcs", "/lang/funcs/simple"}
+
+// ErrNoFuncs is returned by ParseFunctions for an mgmt tree without
+// lang/funcs, such as one trimmed to its resources.
+var ErrNoFuncs = errors.New("mgmt funcs dir not found or invalid")
+
+// ParseFunctions discovers the functions registered in lang/funcs and its
+// sub-packages of the mgmt tree at mgmtRoot, reading only the files opts
+// builds. Registrations whose name or signature is not a constant are
+// returned as diagnostics.
+func ParseFunctions(mgmtRoot string, opts Options) (funcs []FuncInfo, diags []Diagnostic, err error) {
+	funcsDir := filepath.Join(mgmtRoot, "lang", "funcs")
+	if st, e := os.Stat(funcsDir); e != nil || !st.IsDir() {
+		if e == nil {
+			e = errors.New("not a directory")
+		}
+		return nil, nil, fmt.Errorf("%w: %s (%v)", ErrNoFuncs, funcsDir, e)
+	}
+	dirs, err := packageDirs(funcsDir)
+	if err != nil {
+		return nil, nil, fmt.Errorf("failed to walk %s: %w", funcsDir, err)
+	}
+
+	fset := token.NewFileSet()
+	ctx := opts.buildContext()
+	registered := make(map[string]token.Pos) // path -> first registration
+	for _, dir := range dirs {
+		pkg, err := parsePkgDir(fset, ctx, dir)
+		if err != nil {
+			return nil, nil, fmt.Errorf("failed to parse %s: %w", dir, err)
+		}
+		for _, e := range pkg.syntaxErrs {
+			diags = append(diags, diagnosticAt(mgmtRoot, e.Pos, ReasonSyntax, e.Msg))
+		}
+		for _, reg := range collectFuncRegistrations(pkg) {
+			if reg.problem != nil {
+				diags = append(diags, reg.problem.diagnostic(fset, mgmtRoot))
+				continue
+			}
+			path := reg.fn.Path()
+			if first, dup := registered[path]; dup {
+				prev := diagnosticAt(mgmtRoot, fset.Position(first), "", "")
+				diags = append(diags, issue{reg.pos, ReasonDuplicateFunc, fmt.Sprintf("function %s is already registered at %s:%d", path, prev.File, prev.Line)}.diagnostic(fset, mgmtRoot))
+				continue
+			}
+			registered[path] = reg.pos
+			funcs = append(funcs, reg.fn)
+		}
+	}
+	sort.Slice(funcs, func(i, j int) bool {
+		if funcs[i].Module != funcs[j].Module {
+			return funcs[i].Module < funcs[j].Module
+		}
+		return funcs[i].Name < funcs[j].Name
+	})
+	sort.SliceStable(diags, func(i, j int) bool {
+		a, b := diags[i], diags[j]
+		if a.File != b.File {
+			return a.File < b.File
+		}
+		return a.Line < b.Line
+	})
+	return funcs, diags, nil
+}
+
+// packageDirs returns root and the directories below it holding Go files,
+// skipping hidden, vendor and testdata directories.
+func packageDirs(root string) ([]string, error) {
+	var out []string
+	seen := make(map[string]bool)
+	err := filepath.WalkDir(root, func(path string, d fs.DirEntry, err error) error {
+		if err != nil {
+			return err
+		}
+		name := d.Name()
+		if d.IsDir() {
+			if path != root && (strings.HasPrefix(name, ".") || strings.HasPrefix(name, "_") || name == "vendor" || name == "testdata") {
+				return filepath.SkipDir
+			}
+			return nil
+		}
+		dir := filepath.Dir(path)
+		if strings.HasSuffix(name, ".go") && !seen[dir] {
+			seen[dir] = true
+			out = append(out, dir)
+		}
+		return nil
+	})
+	return out, err
+}
+
+// funcRegistration is a Register or ModuleRegister call of a package.
+type funcRegistration struct {
+	pos     token.Pos
+	fn      FuncInfo
+	problem *issue // why the function could not be resolved
+}
+
+// collectFuncRegistrations finds the function registrations of pkg, made
+// through the funcs or simple package under any import name.
+func collectFuncRegistrations(pkg *parsedPkg) []funcRegistration {
+	consts := collectStringConsts(pkg.files)
+	funcs := make(map[string]*ast.FuncDecl)
+	methods := make(map[string][]*ast.FuncDecl) // by receiver type
+	for _, f := range pkg.files {
+		for _, d := range f.Decls {
+			fd, ok := d.(*ast.FuncDecl)
+			if !ok || fd.Body == nil {
+				continue
+			}
+			if fd.Recv == nil {
+				funcs[fd.Name.Name] = fd
+			} else if recv := recvTypeName(fd); recv != "" {
+				methods[recv] = append(methods[recv], fd)
+			}
+		}
+	}
+	structs := collectStructs(pkg.files)
+
+	var out []funcRegistration
+	for _, f := range pkg.files {
+		imports := pkg.importAlias[f]
+		isRegistry := func(e ast.Expr) bool {
+			id, ok := e.(*ast.Ident)
+			if !ok {
+				return false
+			}
+			for _, suffix := range registryPkgs {
+				if strings.HasSuffix(imports[id.Name], suffix) {
+					return true
+				}
+			}
+			return false
+		}
+		ast.Inspect(f, func(n ast.Node) bool {
+			call, ok := n.(*ast.CallExpr)
+			if !ok {
+				return true
+			}
+			sel, ok := call.Fun.(*ast.SelectorExpr)
+			if !ok || (sel.Sel.Name != "Register" && sel.Sel.Name != "ModuleRegister") || !isRegistry(sel.X) {
+				return true
+			}
+			r := funcRegistration{pos: call.Pos()}
+			r.fn, r.problem = resolveFunc(call, sel.Sel.Name == "ModuleRegister", consts, funcs, methods, structs)
+			out = append(out, r)
+			return true
+		})
+	}
+	return out
+}
+
+func resolveFunc(call *ast.CallExpr, module bool, consts map[string]string, funcs map[string]*ast.FuncDecl, methods map[string][]*ast.FuncDecl, structs map[string]structInfo) (FuncInfo, *issue) {
+	var fn FuncInfo
+	fail := func(reason, format string, args ...any) (FuncInfo, *issue) {
+		return fn, &issue{pos: call.Pos(), reason: reason, message: fmt.Sprintf(format, args...)}
+	}
+	args := call.Args
+	want := 2
+	if module {
+		want = 3
+	}
+	if len(args) != want {
+		return fail(ReasonUnresolvedFunc, "registration called with %d arguments", len(args))
+	}
+	if module {
+		var ok bool
+		if fn.Module, ok = stringValue(args[0], consts); !ok {
+			return fail(ReasonUnresolvedFunc, "module %s is not a known string constant", exprToString(args[0]))
+		}
+		args = args[1:]
+	}
+	var ok bool
+	if fn.Name, ok = stringValue(args[0], consts); !ok {
+		return fail(ReasonUnresolvedFunc, "name %s is not a known string constant", exprToString(args[0]))
+	}
+
+	// The signature is in the T field of a &simple.Scaffold{...} or
+	// &types.FuncValue{...}, or in the methods of the struct a constructor
+	// returns.
+	var sigs []ast.Expr
+	var doc string
+	switch v := args[1].(type) {
+	case *ast.UnaryExpr:
+		cl, _ := v.X.(*ast.CompositeLit)
+		if v.Op != token.AND || cl == nil {
+			break
+		}
+		for _, el := range cl.Elts {
+			kv, ok := el.(*ast.KeyValueExpr)
+			if !ok {
+				continue
+			}
+			switch key, _ := kv.Key.(*ast.Ident); {
+			case key == nil:
+			case key.Name == "T":
+				sigs = append(sigs, kv.Value)
+			case key.Name == "F" || key.Name == "V":
+				if id, ok := kv.Value.(*ast.Ident); ok && funcs[id.Name] != nil {
+					doc = docText(funcs[id.Name].Doc)
+				}
+			}
+		}
+	case *ast.FuncLit, *ast.Ident:
+		var body *ast.BlockStmt
+		if lit, ok := v.(*ast.FuncLit); ok {
+			body = lit.Body
+		} else if fd := funcs[v.(*ast.Ident).Name]; fd != nil {
+			body = fd.Body
+		}
+		if body == nil {
+			break
+		}
+		name := returnStructName(body)
+		doc = structs[name].doc
+		for _, m := range methods[name] {
+			ast.Inspect(m.Body, func(n ast.Node) bool {
+				if kv, ok := n.(*ast.KeyValueExpr); ok {
+					if key, ok := kv.Key.(*ast.Ident); ok && key.Name == "Sig" {
+						sigs = append(sigs, kv.Value)
+					}
+				}
+				return true
+			})
+		}
+	}
+	if len(sigs) != 1 {
+		return fail(ReasonUnresolvedSig, "function %s: no single signature found", fn.Path())
+	}
+	sig, ok := newTypeString(sigs[0], consts)
+	if !ok {
+		return fail(ReasonUnresolvedSig, "function %s: signature %s is not a constant types.NewType(...)", fn.Path(), exprToString(sigs[0]))
+	}
+	if fn.Params, fn.Result, ok = parseSignature(sig); !ok {
+		return fail(ReasonUnresolvedSig, "function %s: cannot read signature %q", fn.Path(), sig)
+	}
+	fn.Sig = sig
+	fn.Doc = strings.TrimSpace(doc)
+	return fn, nil
+}
+
+// stringValue evaluates a string literal, a constant of the package or a
+// concatenation of them.
+func stringValue(e ast.Expr, consts map[string]string) (string, bool) {
+	switch x := e.(type) {
+	case *ast.BasicLit:
+		if x.Kind == token.STRING {
+			s, err := strconvUnquote(x.Value)
+			return s, err == nil
+		}
+	case *ast.Ident:
+		s, ok := consts[x.Name]
+		return s, ok
+	case *ast.ParenExpr:
+		return stringValue(x.X, consts)
+	case *ast.BinaryExpr:
+		if x.Op == token.ADD {
+			a, aok := stringValue(x.X, consts)
+			b, bok := stringValue(x.Y, consts)
+			return a + b, aok && bok
+		}
+	}
+	return "", false
+}
+
+// newTypeString returns the signature s of a types.NewType(s) call.
+func newTypeString(e ast.Expr, consts map[string]string) (string, bool) {
+	call, ok := e.(*ast.CallExpr)
+	if !ok || len(call.Args) != 1 {
+		return "", false
+	}
+	if sel, ok := call.Fun.(*ast.SelectorExpr); !ok || sel.Sel.Name != "NewType" {
+		return "", false
+	}
+	return stringValue(call.Args[0], consts)
+}
+
+func recvTypeName(fd *ast.FuncDecl) string {
+	if len(fd.Recv.List) == 0 {
+		return ""
+	}
+	t := fd.Recv.List[0].Type
+	if star, ok := t.(*ast.StarExpr); ok {
+		t = star.X
+	}
+	if id, ok := t.(*ast.Ident); ok {
+		return id.Name
+	}
+	return ""
+}
+
+// parseSignature splits an MCL function signature such as
+// "func(a int, b []str) str" into its params and result.
+func parseSignature(sig string) (params []FuncParam, result string, ok bool) {
+	rest, ok := strings.CutPrefix(strings.TrimSpace(sig), "func(")
+	if !ok {
+		return nil, "", false
+	}
+	end := closingParen(rest)
+	if end < 0 {
+		return nil, "", false
+	}
+	result = strings.TrimSpace(rest[end+1:])
+	if result == "" {
+		return nil, "", false
+	}
+	for _, p := range splitTopLevel(rest[:end]) {
+		p = strings.TrimSpace(p)
+		if p == "" {
+			return nil, "", false
+		}
+		// "name type", unless the first space is within the type, as in
+		// "map{str: int}".
+		if i := strings.IndexByte(p, ' '); i > 0 && !strings.ContainsAny(p[:i], "[]{}()?") {
+			params = append(params, FuncParam{Name: p[:i], Type: strings.TrimSpace(p[i+1:])})
+		} else {
+			params = append(params, FuncParam{Type: p})
+		}
+	}
+	return params, result, true
+}
+
+// closingParen returns the index of the ) closing an already opened (, or
+// -1.
+func closingParen(s string) int {
+	depth := 0
+	for i, c := range s {
+		switch c {
+		case '(', '[', '{':
+			depth++
+		case ']', '}':
+			depth--
+		case ')':
+			if depth == 0 {
+				return i
+			}
+			depth--
+		}
+	}
+	return -1
+}
+
+// splitTopLevel splits s at the commas outside of brackets.
+func splitTopLevel(s string) []string {
+	if strings.TrimSpace(s) == "" {
+		return nil
+	}
+	var out []string
+	depth, start := 0, 0
+	for i, c := range s {
+		switch c {
+		case '(', '[', '{':
+			depth++
+		case ')', ']', '}':
+			depth--
+		case ',':
+			if depth == 0 {
+				out = append(out, s[start:i])
+				start = i + 1
+			}
+		}
+	}
+	return append(out, s[start:])
+}
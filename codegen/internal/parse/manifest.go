@@ -0,0 +1,50 @@
+package parse
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"os"
+)
+
+// ManifestFile is the name cmd/nixos gives the resource manifest it writes
+// next to the generated modules.
+const ManifestFile = "manifest.json"
+
+// WriteManifest writes resources as JSON, so that later codegen steps can
+// look up param types without the mgmt source.
+func WriteManifest(path string, resources []ResourceInfo) error {
+	data, err := json.MarshalIndent(resources, "", "  ")
+	if err != nil {
+		return err
+	}
+	return os.WriteFile(path, append(data, '\n'), 0o644)
+}
+
+// ReadManifest reads a manifest written by WriteManifest.
+func ReadManifest(path string) ([]ResourceInfo, error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+	var resources []ResourceInfo
+	dec := json.NewDecoder(bytes.NewReader(data))
+	dec.UseNumber() // keep example numbers as written
+	if err := dec.Decode(&resources); err != nil {
+		return nil, fmt.Errorf("decode manifest %s: %w", path, err)
+	}
+	return resources, nil
+}
+
+// FuncManifestFile is the name cmd/nixos gives the manifest of language
+// functions it writes next to the generated modules.
+const FuncManifestFile = "functions.json"
+
+// WriteFuncManifest writes funcs as JSON.
+func WriteFuncManifest(path string, funcs []FuncInfo) error {
+	data, err := json.MarshalIndent(funcs, "", "  ")
+	if err != nil {
+		return err
+	}
+	return os.WriteFile(path, append(data, '\n'), 0o644)
+}
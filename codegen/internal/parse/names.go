@@ -0,0 +1,94 @@
+package parse
+
+import (
+	"go/ast"
+	"regexp"
+)
+
+// nameHint matches doc comments that say a param defaults to the resource
+// name, e.g. "Path, which defaults to the name if not specified".
+var nameHint = regexp.MustCompile(`(?i)\bdefaults? to (?:the|its) (?:resource(?:'s)? )?name\b`)
+
+// collectNameDefaults returns struct name -> Go field name for the string
+// fields mgmt replaces with the resource name when they are empty, as in
+//
+//	if obj.Path == "" {
+//		p = obj.Name()
+//	}
+//
+// in any method of the struct.
+func collectNameDefaults(pkg *parsedPkg, structs map[string]structInfo) map[string]map[string]bool {
+	out := make(map[string]map[string]bool)
+	for _, f := range pkg.files {
+		for _, decl := range f.Decls {
+			fd, ok := decl.(*ast.FuncDecl)
+			if !ok || fd.Recv == nil || len(fd.Recv.List) != 1 || len(fd.Recv.List[0].Names) != 1 || fd.Body == nil {
+				continue
+			}
+			recv := fd.Recv.List[0]
+			typ := recv.Type
+			if star, ok := typ.(*ast.StarExpr); ok {
+				typ = star.X
+			}
+			id, ok := typ.(*ast.Ident)
+			if !ok {
+				continue
+			}
+			si, ok := structs[id.Name]
+			if !ok {
+				continue
+			}
+			rc := ruleCollector{recv: recv.Names[0].Name, fields: make(map[string]FieldInfo)}
+			for _, fi := range si.fields {
+				rc.fields[fi.GoName] = fi
+			}
+			ast.Inspect(fd.Body, func(n ast.Node) bool {
+				is, ok := n.(*ast.IfStmt)
+				if !ok {
+					return true
+				}
+				c, ok := rc.condition(is.Cond)
+				if !ok || c.Op != CondZero || !callsName(is.Body, rc.recv) {
+					return true
+				}
+				for _, fi := range si.fields {
+					if fi.LangName == c.Field && fi.GoType == "string" {
+						if out[id.Name] == nil {
+							out[id.Name] = make(map[string]bool)
+						}
+						out[id.Name][fi.GoName] = true
+					}
+				}
+				return true
+			})
+		}
+	}
+	return out
+}
+
+// callsName reports whether body calls recv.Name().
+func callsName(body *ast.BlockStmt, recv string) bool {
+	found := false
+	ast.Inspect(body, func(n ast.Node) bool {
+		call, ok := n.(*ast.CallExpr)
+		if !ok || len(call.Args) != 0 {
+			return !found
+		}
+		if sel, ok := call.Fun.(*ast.SelectorExpr); ok && sel.Sel.Name == "Name" {
+			if id, ok := sel.X.(*ast.Ident); ok && id.Name == recv {
+				found = true
+			}
+		}
+		return !found
+	})
+	return found
+}
+
+// isNameDefault reports whether mgmt uses the resource name for f when it is
+// not set: a method of the resource falls back to Name(), or the doc says so.
+func isNameDefault(f FieldInfo, fromCode bool) bool {
+	if f.GoType != "string" {
+		return false
+	}
+	return fromCode || nameHint.MatchString(f.Doc)
+}
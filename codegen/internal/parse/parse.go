@@ -4,8 +4,11 @@ import (
 	"errors"
 	"fmt"
 	"go/ast"
+	"go/build"
 	"go/parser"
+	"go/scanner"
 	"go/token"
+	"go/types"
 	"os"
 	"path/filepath"
 	"reflect"
@@ -19,6 +22,15 @@ type FieldInfo struct {
 	GoType   string
 	Optional bool   // pointer type in Go
 	Doc      string // field doc
+	Example  any    `json:",omitempty"` // from the field doc or mgmt's examples
+	Default  any    `json:",omitempty"` // set by the resource's Default(); nil if unknown
+	Required bool   `json:",omitempty"` // mgmt rejects the resource without it
+	// DeclType is the type as written when type checking resolved GoType
+	// from it, e.g. "time.Duration" for "int64".
+	DeclType string `json:",omitempty"`
+	// NameDefault is set for string params mgmt fills with the resource
+	// name when they are empty, like file's path.
+	NameDefault bool `json:",omitempty"`
 }
 
 type ResourceInfo struct {
@@ -26,20 +38,30 @@ type ResourceInfo struct {
 	StructName string // e.g. "FileRes"
 	Doc        string // struct doc
 	Fields     []FieldInfo
+	Example    *ResourceExample `json:",omitempty"`
+	Rules      []ValidationRule `json:",omitempty"` // checks from Validate()
+	Consts     []ResourceConst  `json:",omitempty"` // values named under $const.res
 }
 
 type parsedPkg struct {
 	files       []*ast.File
 	importAlias map[*ast.File]map[string]string
+	syntaxErrs  []*scanner.Error // first error of each file that failed to parse
+	info        *types.Info      // set by type checking
 }
 
-func ParseResources(mgmtRoot string) (resources []ResourceInfo, err error) {
+// ParseResources discovers the resources registered in the mgmt tree at
+// mgmtRoot: in engine/resources and its sub-packages, and in any other
+// package calling engine.RegisterResource. Only the files opts builds are
+// read. Registrations it cannot follow to a resource struct are returned as
+// diagnostics.
+func ParseResources(mgmtRoot string, opts Options) (resources []ResourceInfo, diags []Diagnostic, err error) {
 	resDir := filepath.Join(mgmtRoot, "engine", "resources")
 	if st, e := os.Stat(resDir); e != nil || !st.IsDir() {
 		if e == nil {
 			e = errors.New("not a directory")
 		}
-		return nil, fmt.Errorf("required mgmt resources dir not found or invalid: %s (%w)", resDir, e)
+		return nil, nil, fmt.Errorf("required mgmt resources dir not found or invalid: %s (%w)", resDir, e)
 	}
 
 	engDir := filepath.Join(mgmtRoot, "engine")
@@ -47,59 +69,131 @@ func ParseResources(mgmtRoot string) (resources []ResourceInfo, err error) {
 		if e == nil {
 			e = errors.New("not a directory")
 		}
-		return nil, fmt.Errorf("required mgmt engine dir not found or invalid: %s (%w)", engDir, e)
+		return nil, nil, fmt.Errorf("required mgmt engine dir not found or invalid: %s (%w)", engDir, e)
 	}
 
 	fset := token.NewFileSet()
+	ctx := opts.buildContext()
 
-	// Parse packages
-	resPkg, err := parsePkgDir(fset, resDir)
+	engPkg, err := parsePkgDir(fset, ctx, engDir)
 	if err != nil {
-		return nil, fmt.Errorf("failed to parse %s: %w", resDir, err)
+		return nil, nil, fmt.Errorf("failed to parse %s: %w", engDir, err)
 	}
-	if resPkg == nil || len(resPkg.files) == 0 {
-		return nil, fmt.Errorf("no parseable Go files found in %s", resDir)
+	if engPkg == nil || len(engPkg.files) == 0 {
+		return nil, nil, fmt.Errorf("no parseable Go files found in %s", engDir)
 	}
+	engineConsts := collectStringConsts(engPkg.files) // package engine consts
 
-	engPkg, err := parsePkgDir(fset, engDir)
+	dirs, err := resourceDirs(mgmtRoot, resDir, engDir)
 	if err != nil {
-		return nil, fmt.Errorf("failed to parse %s: %w", engDir, err)
+		return nil, nil, fmt.Errorf("failed to walk %s: %w", mgmtRoot, err)
 	}
-	if engPkg == nil || len(engPkg.files) == 0 {
-		return nil, fmt.Errorf("no parseable Go files found in %s", engDir)
+	var tc *typeChecker
+	if opts.TypeCheck {
+		tc = newTypeChecker(fset, ctx, mgmtRoot)
 	}
+	registered := make(map[string]token.Pos) // kind -> first registration
+	docBlocks := make(map[string][]string)   // kind -> MCL examples in the doc
+	var consts []constRegistration
+	for _, dir := range dirs {
+		pkg, err := parsePkgDir(fset, ctx, dir)
+		if err != nil {
+			return nil, nil, fmt.Errorf("failed to parse %s: %w", dir, err)
+		}
+		for _, e := range pkg.syntaxErrs {
+			diags = append(diags, diagnosticAt(mgmtRoot, e.Pos, ReasonSyntax, e.Msg))
+		}
+		var typeErr *issue
+		if tc != nil {
+			typeErr = tc.checkResources(dir, pkg)
+		}
+		structMap := collectStructs(pkg.files)
+		localConsts := collectStringConsts(pkg.files) // package-local consts
+		defaults := collectDefaults(pkg, localConsts, engineConsts)
+		rules := collectRules(pkg, structMap, localConsts, engineConsts)
+		nameDefaults := collectNameDefaults(pkg, structMap)
 
-	// Collect
-	structMap := collectStructs(resPkg.files)
-	localConsts := collectStringConsts(resPkg.files)  // resource-local consts
-	engineConsts := collectStringConsts(engPkg.files) // package engine consts
-
-	regMap := collectRegistrations(resPkg, localConsts, engineConsts)
+		for _, reg := range collectResourceConsts(pkg, localConsts, engineConsts) {
+			if reg.problem != nil {
+				diags = append(diags, reg.problem.diagnostic(fset, mgmtRoot))
+				continue
+			}
+			consts = append(consts, reg)
+		}
+		for _, reg := range collectRegistrations(pkg, localConsts, engineConsts) {
+			if reg.problem != nil {
+				diags = append(diags, reg.problem.diagnostic(fset, mgmtRoot))
+				continue
+			}
+			si, ok := structMap[reg.structName]
+			if !ok {
+				diags = append(diags, issue{reg.pos, ReasonStructNotFound, fmt.Sprintf("kind %q: struct %s is not declared in this package", reg.kind, reg.structName)}.diagnostic(fset, mgmtRoot))
+				continue
+			}
+			if first, dup := registered[reg.kind]; dup {
+				prev := diagnosticAt(mgmtRoot, fset.Position(first), "", "")
+				diags = append(diags, issue{reg.pos, ReasonDuplicateKind, fmt.Sprintf("kind %q is already registered at %s:%d", reg.kind, prev.File, prev.Line)}.diagnostic(fset, mgmtRoot))
+				continue
+			}
+			registered[reg.kind] = reg.pos
+			if typeErr != nil {
+				diags = append(diags, typeErr.diagnostic(fset, mgmtRoot))
+				typeErr = nil // once per package
+			}
+			for _, is := range si.issues {
+				diags = append(diags, is.diagnostic(fset, mgmtRoot))
+			}
 
-	for resName, structName := range regMap {
-		if si, ok := structMap[structName]; ok {
+			structName := reg.structName
+			fields := append([]FieldInfo(nil), si.fields...)
+			for i, f := range fields {
+				expr := si.fieldTypes[f.GoName]
+				if t := pkg.resolvedType(expr); t != "" && t != types.ExprString(expr) {
+					fields[i].DeclType, fields[i].GoType = f.GoType, t
+					f = fields[i]
+				}
+				if !supportedGoType(f.GoType) {
+					diags = append(diags, issue{expr.Pos(), ReasonUnsupportedType, fmt.Sprintf("field %s: %s has no exact option type", f.GoName, f.GoType)}.diagnostic(fset, mgmtRoot))
+				}
+				fields[i].Default = fieldDefault(defaults[structName][f.GoName], f.GoType)
+				fields[i].NameDefault = isNameDefault(f, nameDefaults[structName][f.GoName])
+				fields[i].Required = isRequired(fields[i], rules[structName])
+			}
 			resources = append(resources, ResourceInfo{
-				Name:       resName,
+				Name:       reg.kind,
 				StructName: structName,
 				Doc:        si.doc,
-				Fields:     si.fields,
+				Fields:     fields,
+				Rules:      rules[structName],
 			})
+			docBlocks[reg.kind] = si.codeBlocks
 		}
 	}
 	sort.Slice(resources, func(i, j int) bool { return resources[i].Name < resources[j].Name })
+	addConsts(resources, consts, func(is issue) { diags = append(diags, is.diagnostic(fset, mgmtRoot)) })
+	sort.SliceStable(diags, func(i, j int) bool {
+		a, b := diags[i], diags[j]
+		if a.File != b.File {
+			return a.File < b.File
+		}
+		return a.Line < b.Line
+	})
+	addExamples(mgmtRoot, resources, docBlocks)
 
 	if len(resources) == 0 {
-		return nil, fmt.Errorf("no resources discovered (registrations not found or kinds unresolved)")
+		return nil, diags, fmt.Errorf("no resources discovered (registrations not found or kinds unresolved)")
 	}
-	return resources, nil
+	return resources, diags, nil
 }
 
-func parsePkgDir(fset *token.FileSet, dir string) (*parsedPkg, error) {
+// parsePkgDir parses the Go files of dir that ctx builds, except tests.
+func parsePkgDir(fset *token.FileSet, ctx *build.Context, dir string) (*parsedPkg, error) {
 	ents, err := os.ReadDir(dir)
 	if err != nil {
 		return nil, err
 	}
 	var out []*ast.File
+	var syntaxErrs []*scanner.Error
 	alias := make(map[*ast.File]map[string]string)
 	for _, e := range ents {
 		if e.IsDir() {
@@ -109,9 +203,19 @@ func parsePkgDir(fset *token.FileSet, dir string) (*parsedPkg, error) {
 		if !strings.HasSuffix(name, ".go") || strings.HasSuffix(name, "_test.go") {
 			continue
 		}
+		// A header MatchFile can't read is left to the parser to report.
+		if match, err := ctx.MatchFile(dir, name); err == nil && !match {
+			continue
+		}
 		fn := filepath.Join(dir, name)
 		f, err := parser.ParseFile(fset, fn, nil, parser.ParseComments)
 		if err != nil {
+			var list scanner.ErrorList
+			if errors.As(err, &list) && len(list) > 0 {
+				syntaxErrs = append(syntaxErrs, list[0])
+			} else {
+				syntaxErrs = append(syntaxErrs, &scanner.Error{Pos: token.Position{Filename: fn}, Msg: err.Error()})
+			}
 			continue
 		}
 		out = append(out, f)
@@ -131,14 +235,17 @@ func parsePkgDir(fset *token.FileSet, dir string) (*parsedPkg, error) {
 		}
 		alias[f] = m
 	}
-	return &parsedPkg{files: out, importAlias: alias}, nil
+	return &parsedPkg{files: out, importAlias: alias, syntaxErrs: syntaxErrs}, nil
 }
 
 // --- scan structs
 
 type structInfo struct {
-	doc    string
-	fields []FieldInfo
+	doc        string
+	codeBlocks []string // MCL examples in the doc
+	fields     []FieldInfo
+	fieldTypes map[string]ast.Expr // by Go name
+	issues     []issue             // fields left out
 }
 
 func collectStructs(files []*ast.File) map[string]structInfo {
@@ -159,20 +266,20 @@ func collectStructs(files []*ast.File) map[string]structInfo {
 					continue
 				}
 				doc := strings.TrimSpace(docText(gd.Doc, ts.Doc))
-				fields := extractLangFields(st)
-				if len(fields) > 0 {
-					result[ts.Name.Name] = structInfo{doc: doc, fields: fields}
-				}
+				fields, fieldTypes, issues := extractLangFields(st)
+				result[ts.Name.Name] = structInfo{doc: doc, codeBlocks: codeBlocks(gd.Doc, ts.Doc), fields: fields, fieldTypes: fieldTypes, issues: issues}
 			}
 		}
 	}
 	return result
 }
 
-func extractLangFields(st *ast.StructType) []FieldInfo {
-	var out []FieldInfo
+// extractLangFields returns the lang-tagged fields of st with their type
+// expressions, and issues for exported fields without a lang tag.
+func extractLangFields(st *ast.StructType) (out []FieldInfo, fieldTypes map[string]ast.Expr, issues []issue) {
+	fieldTypes = make(map[string]ast.Expr)
 	if st.Fields == nil {
-		return out
+		return nil, fieldTypes, nil
 	}
 	for _, f := range st.Fields.List {
 		if len(f.Names) == 0 {
@@ -187,19 +294,61 @@ func extractLangFields(st *ast.StructType) []FieldInfo {
 			}
 		}
 		if lang == "" {
+			if ast.IsExported(goName) {
+				issues = append(issues, issue{pos: f.Pos(), reason: ReasonUntaggedField, message: fmt.Sprintf("field %s has no lang tag", goName)})
+			}
 			continue
 		}
 		typ := exprToString(f.Type)
+		fieldTypes[goName] = f.Type
 		optional := isPointerType(f.Type)
 		doc := strings.TrimSpace(docText(f.Doc, f.Comment))
 		out = append(out, FieldInfo{
 			GoName:   goName,
 			LangName: strings.ToLower(lang),
 			GoType:   typ,
-			Optional: optional, // not used for Nix nullability but kept for completeness
+			Optional: optional,
 			Doc:      doc,
+			Example:  fieldExample(typ, f.Doc, f.Comment),
 		})
 	}
 	sort.Slice(out, func(i, j int) bool { return out[i].LangName < out[j].LangName })
-	return out
+	return out, fieldTypes, issues
+}
+
+// supportedGoType reports whether the options have an exact type for a
+// field of type goType.
+func supportedGoType(goType string) bool {
+	e, err := parser.ParseExpr(goType)
+	return err == nil && supportedType(e)
+}
+
+// supportedType reports whether the options have an exact type for a field
+// of type e: basic types, pointers to them, slices of them and maps of
+// strings. Anything else becomes a string option.
+func supportedType(e ast.Expr) bool {
+	basic := func(e ast.Expr) bool {
+		id, ok := e.(*ast.Ident)
+		if !ok {
+			return false
+		}
+		switch id.Name {
+		case "string", "bool", "float32", "float64",
+			"int", "int8", "int16", "int32", "int64",
+			"uint", "uint8", "uint16", "uint32", "uint64":
+			return true
+		}
+		return false
+	}
+	switch x := e.(type) {
+	case *ast.StarExpr:
+		return basic(x.X)
+	case *ast.ArrayType:
+		return x.Len == nil && basic(x.Elt)
+	case *ast.MapType:
+		k, kok := x.Key.(*ast.Ident)
+		v, vok := x.Value.(*ast.Ident)
+		return kok && vok && k.Name == "string" && v.Name == "string"
+	}
+	return basic(e)
 }
@@ -0,0 +1,280 @@
+package parse
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"github.com/karpfediem/rx.nix/codegen/internal/testutil"
+	"os"
+	"path/filepath"
+	"reflect"
+	"strings"
+	"testing"
+)
+
+func TestParseResourcesGolden(t *testing.T) {
+	resources, diags, err := ParseResources(testutil.MgmtFixture, Options{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	got, err := json.MarshalIndent(resources, "", "  ")
+	if err != nil {
+		t.Fatal(err)
+	}
+	testutil.Golden(t, "testdata/resources.golden", append(got, '\n'))
+
+	var report strings.Builder
+	for _, d := range diags {
+		fmt.Fprintln(&report, d)
+	}
+	testutil.Golden(t, "testdata/diagnostics.golden", []byte(report.String()))
+}
+
+func TestParseFunctionsGolden(t *testing.T) {
+	funcs, diags, err := ParseFunctions(testutil.MgmtFixture, Options{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	got, err := json.MarshalIndent(funcs, "", "  ")
+	if err != nil {
+		t.Fatal(err)
+	}
+	var report strings.Builder
+	for _, d := range diags {
+		fmt.Fprintln(&report, d)
+	}
+	testutil.Golden(t, "testdata/functions.golden", append(append(got, '\n'), report.String()...))
+}
+
+func TestParseResourcesMissingDir(t *testing.T) {
+	if _, _, err := ParseResources(t.TempDir(), Options{}); err == nil {
+		t.Fatal("expected an error for a tree without engine/resources")
+	}
+}
+
+func TestParseFunctionsMissingDir(t *testing.T) {
+	if _, _, err := ParseFunctions(t.TempDir(), Options{}); !errors.Is(err, ErrNoFuncs) {
+		t.Fatalf("got error %v, want ErrNoFuncs for a tree without lang/funcs", err)
+	}
+}
+
+// Files the build would leave out are not parsed, so variants of a resource
+// for other platforms or features don't mix.
+func TestParseResourcesBuildConstraints(t *testing.T) {
+	for _, tc := range []struct {
+		opts   Options
+		kinds  []string // present
+		absent []string
+		mount  string // the mount resource's field
+	}{
+		{Options{GOOS: "linux"}, []string{"docker:container", "virt"}, nil, "device"},
+		{Options{GOOS: "darwin", Tags: []string{"nodocker", "novirt"}}, nil, []string{"docker:container", "virt"}, "volume"},
+	} {
+		resources, _, err := ParseResources(testutil.MgmtFixture, tc.opts)
+		if err != nil {
+			t.Fatal(err)
+		}
+		byKind := make(map[string]ResourceInfo)
+		for _, r := range resources {
+			byKind[r.Name] = r
+		}
+		for _, k := range tc.kinds {
+			if _, ok := byKind[k]; !ok {
+				t.Errorf("%+v: %s is missing", tc.opts, k)
+			}
+		}
+		for _, k := range tc.absent {
+			if _, ok := byKind[k]; ok {
+				t.Errorf("%+v: %s is built in", tc.opts, k)
+			}
+		}
+		if f := byKind["mount"].Fields; len(f) != 1 || f[0].LangName != tc.mount {
+			t.Errorf("%+v: mount has fields %+v, want only %s", tc.opts, f, tc.mount)
+		}
+	}
+}
+
+// Type checking resolves named types and aliases to the types the options
+// can map, and keeps the written type.
+func TestParseResourcesTypeCheck(t *testing.T) {
+	resources, _, err := ParseResources(testutil.MgmtFixture, Options{TypeCheck: true})
+	if err != nil {
+		t.Fatal(err)
+	}
+	want := map[string][2]string{ // Go name -> GoType, DeclType
+		"Timeout": {"int64", "time.Duration"},
+		"Labels":  {"map[string]string", "labels"},
+		"Nested":  {"struct{ A string }", ""},
+		"Port":    {"uint16", ""},
+	}
+	for _, r := range resources {
+		if r.Name != "test:exotic" {
+			continue
+		}
+		for _, f := range r.Fields {
+			if w, ok := want[f.GoName]; ok && (f.GoType != w[0] || f.DeclType != w[1]) {
+				t.Errorf("%s: type %q declared %q, want %q declared %q", f.GoName, f.GoType, f.DeclType, w[0], w[1])
+			}
+		}
+	}
+}
+
+// Imports outside the mgmt tree are found from the mgmt module, here through
+// a replace directive, not from the working directory.
+func TestParseResourcesTypeCheckModule(t *testing.T) {
+	root := t.TempDir()
+	files := map[string]string{
+		"go.mod":     "module github.com/purpleidea/mgmt\n\ngo 1.22\n\nrequire example.com/dep v0.0.0\n\nreplace example.com/dep => ./dep\n",
+		"dep/go.mod": "module example.com/dep\n\ngo 1.22\n",
+		"dep/dep.go": "package dep\n\ntype Size int64\n",
+		"engine/engine.go": `package engine
+
+type Res interface{}
+
+func RegisterResource(kind string, fn func() Res) {}
+`,
+		"engine/resources/sized.go": `package resources
+
+import (
+	"example.com/dep"
+	"github.com/purpleidea/mgmt/engine"
+)
+
+func init() {
+	engine.RegisterResource("sized", func() engine.Res { return &SizedRes{} })
+}
+
+type SizedRes struct {
+	Size dep.Size ` + "`lang:\"size\"`" + `
+}
+`,
+	}
+	for name, text := range files {
+		path := filepath.Join(root, filepath.FromSlash(name))
+		if err := os.MkdirAll(filepath.Dir(path), 0o755); err != nil {
+			t.Fatal(err)
+		}
+		if err := os.WriteFile(path, []byte(text), 0o644); err != nil {
+			t.Fatal(err)
+		}
+	}
+	t.Setenv("GOFLAGS", "-mod=mod")
+	t.Setenv("GOPROXY", "off")
+	t.Setenv("GOWORK", "off")
+	t.Chdir(t.TempDir())
+
+	resources, diags, err := ParseResources(root, Options{TypeCheck: true})
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, d := range diags {
+		t.Errorf("unexpected diagnostic %+v", d)
+	}
+	if len(resources) != 1 || len(resources[0].Fields) != 1 {
+		t.Fatalf("got resources %+v, want sized with one field", resources)
+	}
+	if f := resources[0].Fields[0]; f.GoType != "int64" || f.DeclType != "dep.Size" {
+		t.Errorf("size: type %q declared %q, want %q declared %q", f.GoType, f.DeclType, "int64", "dep.Size")
+	}
+}
+
+func TestManifestRoundTrip(t *testing.T) {
+	resources, _, err := ParseResources(testutil.MgmtFixture, Options{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	path := filepath.Join(t.TempDir(), ManifestFile)
+	if err := WriteManifest(path, resources); err != nil {
+		t.Fatal(err)
+	}
+	got, err := ReadManifest(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !reflect.DeepEqual(got, resources) {
+		t.Errorf("manifest reads back as %+v, want %+v", got, resources)
+	}
+}
+
+func TestLeadingLiteral(t *testing.T) {
+	for _, tc := range []struct {
+		text, goType string
+		want         any
+	}{
+		{`"0640" or "u=rw".`, "string", "0640"},
+		{"8080, never -1", "uint16", json.Number("8080")},
+		{"-1 to disable", "uint16", nil},
+		{"1.5 seconds", "float64", json.Number("1.5")},
+		{"`[\"a\", \"b\"]` for two", "[]string", []any{"a", "b"}},
+		{`"x" for a string`, "int", nil},
+		{"a name", "string", nil},
+	} {
+		got, ok := leadingLiteral(tc.text, tc.goType)
+		if !ok {
+			got = nil
+		}
+		if !reflect.DeepEqual(got, tc.want) {
+			t.Errorf("leadingLiteral(%q, %s) = %#v, want %#v", tc.text, tc.goType, got, tc.want)
+		}
+	}
+}
+
+// The conditional and partial requirements are verbatim from mgmt's docs, as
+// in nixos/modules/generated.
+func TestIsRequiredFromDoc(t *testing.T) {
+	for _, tc := range []struct {
+		goName, doc string
+		want        bool
+	}{
+		{"Force", "Force must be set if we want to perform an unusual operation, such as\nchanging a file into a directory or vice-versa. This is also required\nwhen changing a file or directory into a symlink or vice-versa.", false},
+		{"Recurse", "Recurse specifies if you want to work recursively on the resource. It\nis used when copying a source directory, or to determine if a watch\nshould be recursive or not. When making a directory, this is required\nif you'd need the parent directories to be made as well. (Analogous\nto the `mkdir -p` option.)", false},
+		{"IP", "IP is the IPv4 address with the CIDR suffix. The suffix is required\nbecause it specifies the netmask to be used in the DHCPv4 protocol.", false},
+		{"NBP", "NBP is the network boot program URL. This is used for the tftp server\nname and the boot file name. For example, you might use:\ntftp://192.0.2.13/pxelinux.0 for a common bios, pxe boot setup. Note\nthat the \"scheme\" prefix is required, and that it's impossible to\nspecify a file that doesn't begin with a leading slash.", false},
+		{"Runtime", "Runtime specifies whether this value should be set immediately. It\ndefaults to true. If this is not set, then the value must be set in a\nfile and the machine will have to reboot for the setting to take\neffect.", false},
+		{"Key", "Key is the key to set. It is required.", true},
+		{"Name", "Name must be specified.", true},
+		{"Name", "Name is the name to use.", false},
+	} {
+		f := FieldInfo{GoName: tc.goName, LangName: strings.ToLower(tc.goName), GoType: "string", Doc: tc.doc}
+		if got := isRequired(f, nil); got != tc.want {
+			t.Errorf("isRequired(%s) = %v, want %v", tc.goName, got, tc.want)
+		}
+	}
+}
+
+// A doc comment example is the resource example even with fewer params than
+// one in examples/lang, which still gives the fields the doc leaves out.
+func TestAddExamplesPrefersDocComments(t *testing.T) {
+	root := t.TempDir()
+	dir := filepath.Join(root, ExamplesDir)
+	if err := os.MkdirAll(dir, 0o755); err != nil {
+		t.Fatal(err)
+	}
+	src := `file "/tmp/from-examples" {
+	content => "from examples",
+	mode => "0644",
+	owner => "root",
+}
+`
+	if err := os.WriteFile(filepath.Join(dir, "file.mcl"), []byte(src), 0o644); err != nil {
+		t.Fatal(err)
+	}
+	resources := []ResourceInfo{{Name: "file", Fields: []FieldInfo{
+		{LangName: "content", GoType: "string"},
+		{LangName: "mode", GoType: "string"},
+		{LangName: "owner", GoType: "string"},
+	}}}
+	docBlocks := map[string][]string{"file": {`file "/tmp/from-doc" { mode => "0600", }`}}
+
+	addExamples(root, resources, docBlocks)
+	r := resources[0]
+	if r.Example == nil || r.Example.Source != DocCommentSource || r.Example.Name != "/tmp/from-doc" {
+		t.Fatalf("resource example is %+v, want the doc comment's", r.Example)
+	}
+	want := map[string]any{"content": "from examples", "mode": "0600", "owner": "root"}
+	for _, f := range r.Fields {
+		if f.Example != want[f.LangName] {
+			t.Errorf("%s: example %v, want %v", f.LangName, f.Example, want[f.LangName])
+		}
+	}
+}
@@ -0,0 +1,45 @@
+package parse
+
+import (
+	"regexp"
+	"strings"
+)
+
+var (
+	// requiredHint matches doc sentences that say a param must be given.
+	requiredHint = regexp.MustCompile(`(?i)\b(?:(?:is|are) required|must (?:be (?:set|specified|given|provided)|not be empty))\b`)
+	// conditional matches sentences that only require a param in some cases.
+	conditional = regexp.MustCompile(`(?i)\b(?:if|when|unless)\b`)
+	// sentenceEnd splits a doc comment into sentences.
+	sentenceEnd = regexp.MustCompile(`[.!?]\s+`)
+)
+
+// isRequired reports whether mgmt rejects a resource that leaves f unset:
+// Validate() fails when f alone is empty, or its doc says f is required.
+// Pointers, where nil is meaningful, and fields with a default, including
+// the resource name, never are.
+func isRequired(f FieldInfo, rules []ValidationRule) bool {
+	if f.Optional || f.Default != nil || f.NameDefault {
+		return false
+	}
+	for _, r := range rules {
+		if len(r.When) == 1 && r.When[0].Field == f.LangName && r.When[0].Op == CondZero {
+			return true
+		}
+	}
+	return docRequires(f)
+}
+
+// docRequires reports whether f's doc has a sentence about f itself, starting
+// with its name or "It", that requires it without condition, as in "Key is
+// required.". Sentences about a part of f's value, like "The suffix is
+// required", or required only in some cases are not taken.
+func docRequires(f FieldInfo) bool {
+	for _, s := range sentenceEnd.Split(strings.Join(strings.Fields(f.Doc), " "), -1) {
+		subject, _, _ := strings.Cut(s, " ")
+		if (subject == f.GoName || subject == "It") && requiredHint.MatchString(s) && !conditional.MatchString(s) {
+			return true
+		}
+	}
+	return false
+}
@@ -2,6 +2,7 @@ package parse
 
 import (
 	"errors"
+	"fmt"
 	"go/ast"
 	"go/printer"
 	"go/token"
@@ -70,62 +71,102 @@ func collectStringConsts(files []*ast.File) map[string]string {
 	return out
 }
 
-func collectRegistrations(resPkg *parsedPkg, localConsts, engineConsts map[string]string) map[string]string {
-	out := make(map[string]string)
-	for _, f := range resPkg.files {
-		imports := resPkg.importAlias[f]
+// registration is a RegisterResource call of a package.
+type registration struct {
+	pos        token.Pos
+	kind       string
+	structName string
+	problem    *issue // why kind or structName could not be resolved
+}
+
+// collectRegistrations finds the RegisterResource calls of pkg, made through
+// the engine package under any import name, with a function literal or a
+// named function of the package returning &T{...} as the constructor.
+func collectRegistrations(pkg *parsedPkg, localConsts, engineConsts map[string]string) []registration {
+	funcs := make(map[string]*ast.FuncDecl)
+	for _, f := range pkg.files {
+		for _, d := range f.Decls {
+			if fd, ok := d.(*ast.FuncDecl); ok && fd.Recv == nil && fd.Body != nil {
+				funcs[fd.Name.Name] = fd
+			}
+		}
+	}
+
+	var out []registration
+	for _, f := range pkg.files {
+		imports := pkg.importAlias[f]
+		isEngine := func(e ast.Expr) bool {
+			id, ok := e.(*ast.Ident)
+			return ok && strings.HasSuffix(imports[id.Name], "/engine")
+		}
 		ast.Inspect(f, func(n ast.Node) bool {
 			call, ok := n.(*ast.CallExpr)
 			if !ok {
 				return true
 			}
 			sel, ok := call.Fun.(*ast.SelectorExpr)
-			if !ok {
-				return true
-			}
-			ident, ok := sel.X.(*ast.Ident)
-			if !ok || ident.Name != "engine" || sel.Sel.Name != "RegisterResource" {
-				return true
-			}
-			if len(call.Args) != 2 {
-				return true
-			}
-
-			resName := ""
-			switch a := call.Args[0].(type) {
-			case *ast.BasicLit:
-				if a.Kind == token.STRING {
-					if s, err := strconvUnquote(a.Value); err == nil {
-						resName = s
-					}
-				}
-			case *ast.Ident:
-				// constant in the same package (resources)
-				resName = localConsts[a.Name]
-			case *ast.SelectorExpr:
-				// Qualified const: engine.SomeResKind (older trees) or alias.SomeResKind.
-				if pkgIdent, ok := a.X.(*ast.Ident); ok {
-					if pkgPath := imports[pkgIdent.Name]; strings.HasSuffix(pkgPath, "/engine") {
-						resName = engineConsts[a.Sel.Name]
-					}
-				}
-			}
-			if resName == "" {
+			if !ok || sel.Sel.Name != "RegisterResource" || !isEngine(sel.X) {
 				return true
 			}
-			fn, ok := call.Args[1].(*ast.FuncLit)
-			if !ok || fn.Body == nil {
-				return true
-			}
-			if structName := returnStructName(fn.Body); structName != "" {
-				out[resName] = structName
-			}
+			out = append(out, resolveRegistration(call, isEngine, funcs, localConsts, engineConsts))
 			return true
 		})
 	}
 	return out
 }
 
+func resolveRegistration(call *ast.CallExpr, isEngine func(ast.Expr) bool, funcs map[string]*ast.FuncDecl, localConsts, engineConsts map[string]string) registration {
+	r := registration{pos: call.Pos()}
+	fail := func(reason, format string, args ...any) registration {
+		r.problem = &issue{pos: call.Pos(), reason: reason, message: fmt.Sprintf(format, args...)}
+		return r
+	}
+	if len(call.Args) != 2 {
+		return fail(ReasonUnresolvedCtor, "RegisterResource called with %d arguments", len(call.Args))
+	}
+
+	switch a := call.Args[0].(type) {
+	case *ast.BasicLit:
+		if a.Kind == token.STRING {
+			if s, err := strconvUnquote(a.Value); err == nil {
+				r.kind = s
+			}
+		}
+	case *ast.Ident:
+		// constant in the same package
+		r.kind = localConsts[a.Name]
+	case *ast.SelectorExpr:
+		// Qualified const: engine.SomeResKind (older trees) or alias.SomeResKind.
+		if isEngine(a.X) {
+			r.kind = engineConsts[a.Sel.Name]
+		}
+	}
+	if r.kind == "" {
+		return fail(ReasonUnresolvedKind, "kind %s is not a known string constant", exprToString(call.Args[0]))
+	}
+
+	ctor := "function literal"
+	var body *ast.BlockStmt
+	switch fn := call.Args[1].(type) {
+	case *ast.FuncLit:
+		body = fn.Body
+	case *ast.Ident:
+		ctor = fn.Name
+		if fd := funcs[fn.Name]; fd != nil {
+			body = fd.Body
+		}
+	default:
+		ctor = exprToString(fn)
+	}
+	if body != nil {
+		r.structName = returnStructName(body)
+	}
+	if r.structName == "" {
+		return fail(ReasonUnresolvedCtor, "kind %q: constructor %s does not return &T{...}", r.kind, ctor)
+	}
+	return r
+}
+
 func returnStructName(body *ast.BlockStmt) string {
 	for _, stmt := range body.List {
 		if ret, ok := stmt.(*ast.ReturnStmt); ok && len(ret.Results) != 0 {
@@ -144,22 +185,16 @@ func returnStructName(body *ast.BlockStmt) string {
 	return ""
 }
 
+// docText returns the text of doc comments with the comment markers removed
+// and the layout kept, ready for ParseDoc.
 func docText(groups ...*ast.CommentGroup) string {
-	var sb strings.Builder
+	var parts []string
 	for _, g := range groups {
-		if g == nil {
-			continue
-		}
-		for _, c := range g.List {
-			text := strings.TrimSpace(strings.TrimPrefix(c.Text, "//"))
-			text = strings.TrimSpace(strings.TrimSuffix(strings.TrimPrefix(text, "/*"), "*/"))
-			if sb.Len() > 0 {
-				sb.WriteByte('\n')
-			}
-			sb.WriteString(text)
+		if t := strings.TrimRight(g.Text(), "\n"); t != "" {
+			parts = append(parts, t)
 		}
 	}
-	return sb.String()
+	return strings.Join(parts, "\n")
 }
 
 func isPointerType(e ast.Expr) bool { _, ok := e.(*ast.StarExpr); return ok }
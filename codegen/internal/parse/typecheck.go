@@ -0,0 +1,198 @@
+package parse
+
+import (
+	"bufio"
+	"fmt"
+	"go/ast"
+	"go/build"
+	"go/token"
+	"go/types"
+	"os"
+	"path/filepath"
+	"strings"
+)
+
+// defaultModule is mgmt's module path, for trees without a go.mod.
+const defaultModule = "github.com/purpleidea/mgmt"
+
+// typeChecker type-checks packages of the mgmt tree from source. Packages of
+// the mgmt module and of its vendor directory are parsed with the build
+// context of the options; anything else, such as the standard library or
+// modules in the module cache, is found by the go command run in the mgmt
+// tree, as when building mgmt, whatever the working directory. That works
+// offline with a filled module cache and GOPROXY=off.
+type typeChecker struct {
+	fset   *token.FileSet
+	ctx    *build.Context
+	root   string
+	module string
+	pkgs   map[string]*types.Package
+	// lookup is ctx run from the mgmt tree, without cgo, whose files can't
+	// be type-checked from source alone.
+	lookup *build.Context
+}
+
+func newTypeChecker(fset *token.FileSet, ctx *build.Context, mgmtRoot string) *typeChecker {
+	if abs, err := filepath.Abs(mgmtRoot); err == nil {
+		mgmtRoot = abs
+	}
+	lookup := *ctx
+	lookup.Dir = mgmtRoot
+	lookup.CgoEnabled = false
+	return &typeChecker{
+		fset:   fset,
+		ctx:    ctx,
+		root:   mgmtRoot,
+		module: modulePath(mgmtRoot),
+		pkgs:   make(map[string]*types.Package),
+		lookup: &lookup,
+	}
+}
+
+// modulePath reads the module path from the go.mod in root.
+func modulePath(root string) string {
+	f, err := os.Open(filepath.Join(root, "go.mod"))
+	if err != nil {
+		return defaultModule
+	}
+	defer f.Close()
+	sc := bufio.NewScanner(f)
+	for sc.Scan() {
+		if rest, ok := strings.CutPrefix(strings.TrimSpace(sc.Text()), "module "); ok {
+			return strings.Trim(strings.TrimSpace(rest), `"`)
+		}
+	}
+	return defaultModule
+}
+
+func (tc *typeChecker) Import(path string) (*types.Package, error) {
+	if p, ok := tc.pkgs[path]; ok {
+		return p, nil
+	}
+	if path == "unsafe" {
+		return types.Unsafe, nil
+	}
+	ctx := tc.ctx
+	var dir string
+	if rel, ok := strings.CutPrefix(path, tc.module); ok && (rel == "" || rel[0] == '/') {
+		dir = filepath.Join(tc.root, filepath.FromSlash(rel))
+	} else if vendored := filepath.Join(tc.root, "vendor", filepath.FromSlash(path)); isDir(vendored) {
+		dir = vendored
+	} else {
+		bp, err := tc.lookup.Import(path, tc.root, build.FindOnly)
+		if err != nil {
+			return nil, err
+		}
+		dir, ctx = bp.Dir, tc.lookup
+	}
+	pkg, err := parsePkgDir(tc.fset, ctx, dir)
+	if err != nil {
+		return nil, err
+	}
+	p, _ := tc.check(path, pkg)
+	return p, nil
+}
+
+// check type-checks the parsed files of pkg as import path path. Types that
+// depend on errors, such as failed imports, are invalid; the rest is still
+// resolved. It returns the errors found.
+func (tc *typeChecker) check(path string, pkg *parsedPkg) (*types.Package, []types.Error) {
+	var errs []types.Error
+	conf := types.Config{
+		Importer: tc,
+		Error: func(err error) {
+			if te, ok := err.(types.Error); ok && !te.Soft {
+				errs = append(errs, te)
+			}
+		},
+	}
+	p, _ := conf.Check(path, tc.fset, pkg.files, pkg.info)
+	tc.pkgs[path] = p
+	return p, errs
+}
+
+// checkResources type-checks a package holding resources in dir and returns
+// a diagnostic for its errors, if any.
+func (tc *typeChecker) checkResources(dir string, pkg *parsedPkg) *issue {
+	path := tc.module
+	if abs, err := filepath.Abs(dir); err == nil {
+		dir = abs
+	}
+	if rel, err := filepath.Rel(tc.root, dir); err == nil && rel != "." {
+		path += "/" + filepath.ToSlash(rel)
+	}
+	pkg.info = &types.Info{Types: make(map[ast.Expr]types.TypeAndValue)}
+	_, errs := tc.check(path, pkg)
+	if len(errs) == 0 {
+		return nil
+	}
+	msg := errs[0].Msg
+	if len(errs) > 1 {
+		msg = fmt.Sprintf("%s (and %d more)", msg, len(errs)-1)
+	}
+	return &issue{pos: errs[0].Pos, reason: ReasonTypeError, message: msg + "; fields whose types depend on errors keep their written type"}
+}
+
+// resolvedType returns the type of a field type expression with named
+// types replaced by what they stand for, e.g. "int64" for time.Duration, or
+// "" if the type is not known.
+func (pkg *parsedPkg) resolvedType(e ast.Expr) string {
+	if pkg.info == nil {
+		return ""
+	}
+	t := pkg.info.TypeOf(e)
+	if t == nil {
+		return ""
+	}
+	return underlyingString(t)
+}
+
+func underlyingString(t types.Type) string {
+	switch x := types.Unalias(t).(type) {
+	case *types.Named, *types.TypeParam:
+		return underlyingString(x.Underlying())
+	case *types.Basic:
+		if x.Kind() == types.Invalid {
+			return ""
+		}
+		return types.Typ[x.Kind()].Name() // byte and rune by their real names
+	case *types.Pointer:
+		if elem := underlyingString(x.Elem()); elem != "" {
+			return "*" + elem
+		}
+	case *types.Slice:
+		if elem := underlyingString(x.Elem()); elem != "" {
+			return "[]" + elem
+		}
+	case *types.Array:
+		if elem := underlyingString(x.Elem()); elem != "" {
+			return fmt.Sprintf("[%d]%s", x.Len(), elem)
+		}
+	case *types.Map:
+		k, v := underlyingString(x.Key()), underlyingString(x.Elem())
+		if k != "" && v != "" {
+			return "map[" + k + "]" + v
+		}
+	case *types.Interface:
+		if x.Empty() {
+			return "interface{}"
+		}
+		return types.TypeString(x, (*types.Package).Name)
+	case *types.Struct:
+		for i := 0; i < x.NumFields(); i++ {
+			if underlyingString(x.Field(i).Type()) == "" {
+				return ""
+			}
+		}
+		return types.TypeString(x, (*types.Package).Name)
+	default:
+		// funcs and channels by their written form
+		return types.TypeString(x, (*types.Package).Name)
+	}
+	return ""
+}
+
+func isDir(path string) bool {
+	st, err := os.Stat(path)
+	return err == nil && st.IsDir()
+}
@@ -0,0 +1,279 @@
+package parse
+
+import (
+	"encoding/json"
+	"go/ast"
+	"go/token"
+	"strconv"
+)
+
+// ValidationRule is a check from a resource's Validate() method: the
+// resource is invalid when every condition in When holds.
+type ValidationRule struct {
+	When    []Condition
+	Message string // the error Validate() returns
+}
+
+// Condition is a test of a single field, by lang name.
+type Condition struct {
+	Field string
+	Op    string // one of the Cond* constants
+	Value any    `json:",omitempty"` // for CondEq and CondNe; numbers are json.Number
+}
+
+// Condition ops. A field that is not set in Nix has mgmt's default value, or
+// the zero value of its type.
+const (
+	CondZero     = "zero"     // the zero value: "", 0, false, empty or nil
+	CondSet      = "set"      // not the zero value
+	CondEq       = "eq"       // equal to Value
+	CondNe       = "ne"       // not equal to Value
+	CondRelative = "relative" // a string not starting with "/"
+)
+
+// collectRules reads the Validate() methods of the resource structs and
+// returns struct name -> the rules of the form
+//
+//	if <conditions> {
+//		return fmt.Errorf("message") // or errors.New
+//	}
+//
+// at the top level of the method, where the conditions only compare fields
+// with constants, check them for emptiness, or check paths for being
+// absolute, joined by && and ||. Other checks are skipped.
+func collectRules(pkg *parsedPkg, structs map[string]structInfo, localConsts, engineConsts map[string]string) map[string][]ValidationRule {
+	out := make(map[string][]ValidationRule)
+	for _, f := range pkg.files {
+		ev := constEval{imports: pkg.importAlias[f], local: localConsts, engine: engineConsts}
+		for _, decl := range f.Decls {
+			fd, ok := decl.(*ast.FuncDecl)
+			if !ok || fd.Name.Name != "Validate" || fd.Recv == nil || len(fd.Recv.List) != 1 || fd.Body == nil {
+				continue
+			}
+			recv := fd.Recv.List[0]
+			typ := recv.Type
+			if star, ok := typ.(*ast.StarExpr); ok {
+				typ = star.X
+			}
+			id, ok := typ.(*ast.Ident)
+			if !ok || len(recv.Names) != 1 {
+				continue
+			}
+			si, ok := structs[id.Name]
+			if !ok {
+				continue
+			}
+			rc := ruleCollector{ev: ev, recv: recv.Names[0].Name, fields: make(map[string]FieldInfo)}
+			for _, fi := range si.fields {
+				rc.fields[fi.GoName] = fi
+			}
+			for _, stmt := range fd.Body.List {
+				out[id.Name] = append(out[id.Name], rc.rules(stmt)...)
+			}
+		}
+	}
+	return out
+}
+
+type ruleCollector struct {
+	ev     constEval
+	recv   string               // the receiver's name, e.g. "obj"
+	fields map[string]FieldInfo // by Go name
+}
+
+func (rc ruleCollector) rules(stmt ast.Stmt) []ValidationRule {
+	is, ok := stmt.(*ast.IfStmt)
+	if !ok || is.Init != nil || is.Else != nil || len(is.Body.List) != 1 {
+		return nil
+	}
+	ret, ok := is.Body.List[0].(*ast.ReturnStmt)
+	if !ok || len(ret.Results) != 1 {
+		return nil
+	}
+	msg, ok := errorMessage(ret.Results[0])
+	if !ok {
+		return nil
+	}
+	var rules []ValidationRule
+	for _, conj := range disjuncts(is.Cond) {
+		var when []Condition
+		for _, e := range conjuncts(conj) {
+			c, ok := rc.condition(e)
+			if !ok {
+				return nil
+			}
+			when = append(when, c)
+		}
+		rules = append(rules, ValidationRule{When: when, Message: msg})
+	}
+	return rules
+}
+
+// errorMessage returns the message of fmt.Errorf("...") or errors.New("...")
+// without format arguments.
+func errorMessage(e ast.Expr) (string, bool) {
+	call, ok := e.(*ast.CallExpr)
+	if !ok || len(call.Args) != 1 {
+		return "", false
+	}
+	sel, ok := call.Fun.(*ast.SelectorExpr)
+	if !ok {
+		return "", false
+	}
+	pkg, ok := sel.X.(*ast.Ident)
+	if !ok || !(pkg.Name == "fmt" && sel.Sel.Name == "Errorf" || pkg.Name == "errors" && sel.Sel.Name == "New") {
+		return "", false
+	}
+	lit, ok := call.Args[0].(*ast.BasicLit)
+	if !ok || lit.Kind != token.STRING {
+		return "", false
+	}
+	s, err := strconv.Unquote(lit.Value)
+	return s, err == nil
+}
+
+func disjuncts(e ast.Expr) []ast.Expr {
+	e = unparen(e)
+	if b, ok := e.(*ast.BinaryExpr); ok && b.Op == token.LOR {
+		return append(disjuncts(b.X), disjuncts(b.Y)...)
+	}
+	return []ast.Expr{e}
+}
+
+func conjuncts(e ast.Expr) []ast.Expr {
+	e = unparen(e)
+	if b, ok := e.(*ast.BinaryExpr); ok && b.Op == token.LAND {
+		return append(conjuncts(b.X), conjuncts(b.Y)...)
+	}
+	return []ast.Expr{e}
+}
+
+func unparen(e ast.Expr) ast.Expr {
+	for {
+		p, ok := e.(*ast.ParenExpr)
+		if !ok {
+			return e
+		}
+		e = p.X
+	}
+}
+
+// condition translates a single comparison.
+func (rc ruleCollector) condition(e ast.Expr) (Condition, bool) {
+	switch x := unparen(e).(type) {
+	case *ast.SelectorExpr: // obj.Flag
+		if f, ok := rc.field(x); ok {
+			return Condition{Field: f.LangName, Op: CondSet}, true
+		}
+	case *ast.UnaryExpr:
+		if x.Op != token.NOT {
+			break
+		}
+		if sel, ok := unparen(x.X).(*ast.SelectorExpr); ok { // !obj.Flag
+			if f, ok := rc.field(sel); ok {
+				return Condition{Field: f.LangName, Op: CondZero}, true
+			}
+		}
+		if call, ok := unparen(x.X).(*ast.CallExpr); ok { // !filepath.IsAbs(obj.Path)
+			if f, ok := rc.absCheck(call); ok {
+				return Condition{Field: f.LangName, Op: CondRelative}, true
+			}
+		}
+	case *ast.BinaryExpr:
+		return rc.comparison(x)
+	}
+	return Condition{}, false
+}
+
+func (rc ruleCollector) comparison(b *ast.BinaryExpr) (Condition, bool) {
+	lhs, rhs := unparen(b.X), unparen(b.Y)
+	// len(obj.Field) compared with 0
+	if call, ok := lhs.(*ast.CallExpr); ok {
+		if fn, ok := call.Fun.(*ast.Ident); ok && fn.Name == "len" && len(call.Args) == 1 {
+			sel, ok := unparen(call.Args[0]).(*ast.SelectorExpr)
+			if !ok {
+				return Condition{}, false
+			}
+			f, ok := rc.field(sel)
+			if lit, isLit := rhs.(*ast.BasicLit); !ok || !isLit || lit.Value != "0" {
+				return Condition{}, false
+			}
+			switch b.Op {
+			case token.EQL, token.LEQ:
+				return Condition{Field: f.LangName, Op: CondZero}, true
+			case token.NEQ, token.GTR:
+				return Condition{Field: f.LangName, Op: CondSet}, true
+			}
+			return Condition{}, false
+		}
+	}
+	sel, ok := lhs.(*ast.SelectorExpr)
+	if !ok {
+		return Condition{}, false
+	}
+	f, ok := rc.field(sel)
+	if !ok || (b.Op != token.EQL && b.Op != token.NEQ) {
+		return Condition{}, false
+	}
+	zero := false
+	var v any
+	if id, ok := rhs.(*ast.Ident); ok && id.Name == "nil" {
+		zero = true
+	} else if v, ok = rc.ev.eval(rhs); !ok {
+		return Condition{}, false
+	} else {
+		switch x := v.(type) {
+		case string:
+			zero = x == ""
+		case bool:
+			zero = !x
+		case json.Number:
+			zero = x == "0"
+		}
+	}
+	switch {
+	case zero && b.Op == token.EQL:
+		return Condition{Field: f.LangName, Op: CondZero}, true
+	case zero:
+		return Condition{Field: f.LangName, Op: CondSet}, true
+	case b.Op == token.EQL:
+		return Condition{Field: f.LangName, Op: CondEq, Value: v}, true
+	}
+	return Condition{Field: f.LangName, Op: CondNe, Value: v}, true
+}
+
+// absCheck matches filepath.IsAbs(obj.F), path.IsAbs(obj.F) and
+// strings.HasPrefix(obj.F, "/").
+func (rc ruleCollector) absCheck(call *ast.CallExpr) (FieldInfo, bool) {
+	fn, ok := call.Fun.(*ast.SelectorExpr)
+	if !ok || len(call.Args) == 0 {
+		return FieldInfo{}, false
+	}
+	pkg, ok := fn.X.(*ast.Ident)
+	if !ok {
+		return FieldInfo{}, false
+	}
+	switch {
+	case (pkg.Name == "filepath" || pkg.Name == "path") && fn.Sel.Name == "IsAbs" && len(call.Args) == 1:
+	case pkg.Name == "strings" && fn.Sel.Name == "HasPrefix" && len(call.Args) == 2:
+		if v, ok := rc.ev.eval(call.Args[1]); !ok || v != "/" {
+			return FieldInfo{}, false
+		}
+	default:
+		return FieldInfo{}, false
+	}
+	sel, ok := unparen(call.Args[0]).(*ast.SelectorExpr)
+	if !ok {
+		return FieldInfo{}, false
+	}
+	return rc.field(sel)
+}
+
+// field resolves obj.Field to a lang field of the resource.
+func (rc ruleCollector) field(sel *ast.SelectorExpr) (FieldInfo, bool) {
+	if id, ok := sel.X.(*ast.Ident); !ok || id.Name != rc.recv {
+		return FieldInfo{}, false
+	}
+	f, ok := rc.fields[sel.Sel.Name]
+	return f, ok
+}
@@ -0,0 +1,108 @@
+// Package selection re-implements the rx.nix projection rules of
+// lib/ir/convert (collect-policies.nix, match-policy.nix, select-files.nix)
+// on a JSON dump of an evaluated NixOS configuration, so the rules can be
+// exercised without a full Nix evaluation.
+//
+// The selection of systemd services has no Nix counterpart yet, as
+// select-systemd.nix is still empty: SelectServices applies the rules of the
+// files to services, and HostIR's svc resources are new behaviour that the
+// Nix projection will have to match once it is written.
+package selection
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+)
+
+// Dump is the JSON dump of one NixOS configuration, e.g. produced with
+//
+//	nix eval --json .#nixosConfigurations.<host> --apply 'c: {
+//	  rx = c.config.rx;
+//	  etc = c.config.environment.etc;
+//	  etcDefinitions = map (d: { inherit (d) file; value = builtins.mapAttrs (_: _: null) d.value; })
+//	    c.options.environment.etc.definitionsWithLocations;
+//	  systemd.services = builtins.mapAttrs (_: s: { inherit (s) enable wantedBy; }) c.config.systemd.services;
+//	  systemdDefinitions = map (d: { inherit (d) file; value = builtins.mapAttrs (_: _: null) d.value; })
+//	    c.options.systemd.services.definitionsWithLocations;
+//	}'
+//
+// Only the attribute names of definition values are used, so they may be
+// stubbed out as above.
+type Dump struct {
+	Rx                 map[string]any            `json:"rx"`
+	Etc                map[string]map[string]any `json:"etc"`
+	EtcDefinitions     []Definition              `json:"etcDefinitions"`
+	Systemd            Systemd                   `json:"systemd"`
+	SystemdDefinitions []Definition              `json:"systemdDefinitions"`
+}
+
+// Systemd holds the systemd options read from the dump.
+type Systemd struct {
+	Services map[string]map[string]any `json:"services"`
+}
+
+// Definition is one entry of an option's definitionsWithLocations.
+type Definition struct {
+	File  string         `json:"file"`
+	Value map[string]any `json:"value"`
+}
+
+// DecodeDump decodes a single-host dump. Numbers are kept as json.Number,
+// as in ir.Decode.
+func DecodeDump(raw []byte) (Dump, error) {
+	var d Dump
+	dec := json.NewDecoder(bytes.NewReader(raw))
+	dec.UseNumber()
+	if err := dec.Decode(&d); err != nil {
+		return Dump{}, err
+	}
+	return d, nil
+}
+
+// IsDump reports whether a decoded top-level JSON object looks like a
+// single-host dump rather than a map of host name to dump. Like
+// ir.IsDocument it goes by the values, so that hosts may be named rx or etc:
+// in a map of dumps every value is an object of dump keys.
+func IsDump(probe map[string]any) bool {
+	for _, v := range probe {
+		dump, ok := v.(map[string]any)
+		if !ok {
+			return true
+		}
+		for k := range dump {
+			if !dumpKeys[k] {
+				return true
+			}
+		}
+	}
+	return false
+}
+
+// dumpKeys are the keys of a Dump in JSON.
+var dumpKeys = map[string]bool{"rx": true, "etc": true, "etcDefinitions": true, "systemd": true, "systemdDefinitions": true}
+
+// origins maps each key of definitions to the files defining it, like
+// origins/etc-origins.nix.
+func origins(defs []Definition) map[string][]string {
+	out := make(map[string][]string)
+	for _, d := range defs {
+		for k := range d.Value {
+			out[k] = append(out[k], d.File)
+		}
+	}
+	return out
+}
+
+// attrs returns m[key] as an attrset, or nil if it is missing or null.
+func attrs(m map[string]any, key string) (map[string]any, error) {
+	v, ok := m[key]
+	if !ok || v == nil {
+		return nil, nil
+	}
+	a, ok := v.(map[string]any)
+	if !ok {
+		return nil, fmt.Errorf("%s: expected an attrset, got %T", key, v)
+	}
+	return a, nil
+}
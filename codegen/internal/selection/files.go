@@ -0,0 +1,173 @@
+package selection
+
+import (
+	"fmt"
+	"sort"
+	"strings"
+)
+
+// FileRecord is a selected file, like an item of files-from-includes.nix.
+// Exactly one of Text and Source is set.
+type FileRecord struct {
+	Path      string
+	Owner     string
+	Group     string
+	Mode      string
+	EnsureDir bool
+	Text      *string
+	Source    *string
+}
+
+// SelectFiles selects the /etc files and rx.files entries to manage, with
+// the semantics of select/select-files.nix followed by the validation of
+// merge/files-from-includes.nix. Records are sorted by path.
+func SelectFiles(d Dump) ([]FileRecord, error) {
+	if !enabled(d.Rx) {
+		return nil, nil
+	}
+	pol, err := CollectPolicies(d.Rx)
+	if err != nil {
+		return nil, err
+	}
+	etcOrigins := origins(d.EtcDefinitions)
+	rxFiles, err := attrs(d.Rx, "files")
+	if err != nil {
+		return nil, err
+	}
+
+	// includes: explicit, by policy, and every rx.files entry
+	included := make(map[string]bool)
+	for p, entry := range pol.Include.Files {
+		if entry["enable"] == true {
+			included[p] = true
+		}
+	}
+	for key, paths := range etcOrigins {
+		if MatchPolicy(pol.Include.ByPolicy, KindFiles, paths) {
+			included["/etc/"+key] = true
+		}
+	}
+	for p := range rxFiles {
+		included[p] = true
+	}
+
+	// excludes: explicit, and by policy for /etc paths
+	var out []FileRecord
+	for _, p := range sortedKeys(included) {
+		if pol.Exclude.Files[p]["enable"] == true {
+			continue
+		}
+		key, isEtc := strings.CutPrefix(p, "/etc/")
+		if isEtc && MatchPolicy(pol.Exclude.ByPolicy, KindFiles, etcOrigins[key]) {
+			continue
+		}
+
+		var merged map[string]any
+		if isEtc {
+			merged = etcDefaults(d.Etc[key])
+			overlay(merged, pol.Include.Files[p], "enable")
+		} else {
+			merged = map[string]any{"owner": "root", "group": "root", "mode": "0644", "ensureDir": true}
+		}
+		rxEntry, _ := rxFiles[p].(map[string]any)
+		overlay(merged, rxEntry)
+
+		rec, err := fileRecord(p, merged)
+		if err != nil {
+			return nil, err
+		}
+		out = append(out, rec)
+	}
+	return out, nil
+}
+
+// etcDefaults derives a record from environment.etc.<key> (which may be nil),
+// like mkEtcRecord in select-files.nix.
+func etcDefaults(e map[string]any) map[string]any {
+	out := map[string]any{"owner": "root", "group": "root", "mode": "0644", "ensureDir": true}
+	if e == nil {
+		return out
+	}
+	if v, ok := e["user"]; ok {
+		out["owner"] = v
+	}
+	if v, ok := e["group"]; ok {
+		out["group"] = v
+	}
+	if v, ok := e["mode"]; ok {
+		out["mode"] = v
+	}
+	if t, ok := e["text"]; ok && t != nil {
+		out["text"] = t
+	} else if s, ok := e["source"]; ok {
+		out["source"] = s
+	} else if t, ok := e["target"]; ok {
+		out["source"] = t
+	}
+	return out
+}
+
+// overlay copies the non-null entries of src into dst, skipping the given
+// keys.
+func overlay(dst, src map[string]any, skip ...string) {
+	for k, v := range src {
+		if v == nil || contains(skip, k) {
+			continue
+		}
+		dst[k] = v
+	}
+}
+
+func fileRecord(path string, m map[string]any) (FileRecord, error) {
+	rec := FileRecord{Path: path, EnsureDir: true}
+	var err error
+	str := func(key string) string {
+		s, ok := m[key].(string)
+		if !ok && err == nil {
+			err = fmt.Errorf("rx.files %s: %s must be a string, got %T", path, key, m[key])
+		}
+		return s
+	}
+	rec.Owner, rec.Group, rec.Mode = str("owner"), str("group"), str("mode")
+	if b, ok := m["ensureDir"].(bool); ok {
+		rec.EnsureDir = b
+	}
+	if err != nil {
+		return FileRecord{}, err
+	}
+
+	count := 0
+	if t, ok := m["text"].(string); ok {
+		rec.Text = &t
+		count++
+	}
+	if s, ok := m["source"].(string); ok {
+		rec.Source = &s
+		count++
+	}
+	if m["generator"] != nil && m["value"] != nil {
+		return FileRecord{}, fmt.Errorf("rx.files %s: generator+value cannot be evaluated outside Nix", path)
+	}
+	if count != 1 {
+		return FileRecord{}, fmt.Errorf("rx.files %s: set exactly one of text | source | (generator+value)", path)
+	}
+	return rec, nil
+}
+
+func contains(list []string, s string) bool {
+	for _, x := range list {
+		if x == s {
+			return true
+		}
+	}
+	return false
+}
+
+func sortedKeys[V any](m map[string]V) []string {
+	keys := make([]string, 0, len(m))
+	for k := range m {
+		keys = append(keys, k)
+	}
+	sort.Strings(keys)
+	return keys
+}
@@ -0,0 +1,84 @@
+package selection
+
+import "github.com/karpfediem/rx.nix/codegen/internal/ir"
+
+// HostIR projects the selected files and services of a dump into host IR:
+// files become mgmt `file` resources and services `svc` resources. The MCL
+// imports, vars and raw blocks of config.rx.mcl are carried over as-is.
+//
+// A file whose mode is "symlink", environment.etc's default, gets no mode
+// param, as mgmt only takes octal modes; its content is managed as a regular
+// file. A service is kept running if it is enabled, and started at boot if
+// it is also wanted by a target; a disabled service is stopped and disabled.
+// This mapping is rx.nix's own, as the Nix side does not select services.
+func HostIR(d Dump) (ir.Host, error) {
+	files, err := SelectFiles(d)
+	if err != nil {
+		return ir.Host{}, err
+	}
+	h := ir.Host{
+		Imports: []string{"deploy"},
+		Vars:    map[string]any{},
+		Res:     map[string]map[string]map[string]any{},
+	}
+	if mcl, _ := attrs(d.Rx, "mcl"); mcl != nil {
+		if imps, ok := mcl["imports"].([]any); ok {
+			for _, s := range imps {
+				if s, ok := s.(string); ok && !contains(h.Imports, s) {
+					h.Imports = append(h.Imports, s)
+				}
+			}
+		}
+		if vars, ok := mcl["vars"].(map[string]any); ok {
+			h.Vars = vars
+		}
+		if raw, ok := mcl["raw"].([]any); ok {
+			for _, s := range raw {
+				if s, ok := s.(string); ok {
+					h.Raw = append(h.Raw, s)
+				}
+			}
+		}
+	}
+
+	for _, f := range files {
+		params := map[string]any{
+			"state": "exists",
+			"owner": f.Owner,
+			"group": f.Group,
+		}
+		// "symlink" is not a mode mgmt understands; see above.
+		if f.Mode != "symlink" {
+			params["mode"] = f.Mode
+		}
+		if f.Text != nil {
+			params["content"] = *f.Text
+		} else {
+			params["source"] = *f.Source
+		}
+		addRes(h, "file", f.Path, params)
+	}
+
+	services, err := SelectServices(d)
+	if err != nil {
+		return ir.Host{}, err
+	}
+	for _, s := range services {
+		params := map[string]any{"state": "stopped", "startup": "disabled"}
+		if s.Enable {
+			params["state"] = "running"
+		}
+		if s.Enable && len(s.WantedBy) > 0 {
+			params["startup"] = "enabled"
+		}
+		addRes(h, "svc", s.Name, params)
+	}
+	return h, nil
+}
+
+func addRes(h ir.Host, kind, name string, params map[string]any) {
+	if h.Res[kind] == nil {
+		h.Res[kind] = map[string]map[string]any{}
+	}
+	h.Res[kind][name] = params
+}
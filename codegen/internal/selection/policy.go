@@ -0,0 +1,123 @@
+package selection
+
+import (
+	"fmt"
+	"strings"
+)
+
+// Kinds of resources a by-policy rule can enable.
+const (
+	KindFiles    = "files"
+	KindSystemd  = "systemd"
+	KindPackages = "packages"
+)
+
+// Policies is the normalized rx include/exclude configuration, like
+// policy/collect-policies.nix.
+type Policies struct {
+	Include Rules
+	Exclude Rules
+}
+
+// Rules is one side (include or exclude) of the policies.
+type Rules struct {
+	// ByPolicy maps an origin path substring to the kinds it enables.
+	ByPolicy map[string]map[string]bool
+	// Files and Systemd map a path or unit name to its explicit entry. For
+	// includes the entry is the attrset with a boolean "enable"; for
+	// excludes it is {"enable": <bool>}.
+	Files   map[string]map[string]any
+	Systemd map[string]map[string]any
+}
+
+// CollectPolicies normalizes config.rx like collect-policies.nix. Explicit
+// entries that Nix would fail to negate are an error.
+func CollectPolicies(rx map[string]any) (Policies, error) {
+	inc, _ := attrs(rx, "include")
+	exc, _ := attrs(rx, "exclude")
+	var pol Policies
+	var err error
+	for _, side := range []struct {
+		rules   *Rules
+		name    string
+		m       map[string]any
+		exclude bool
+	}{{&pol.Include, "include", inc, false}, {&pol.Exclude, "exclude", exc, true}} {
+		side.rules.ByPolicy = normByPolicy(side.m)
+		if side.rules.Files, err = normExplicit(side.m, side.name, KindFiles, side.exclude); err != nil {
+			return Policies{}, err
+		}
+		if side.rules.Systemd, err = normExplicit(side.m, side.name, KindSystemd, side.exclude); err != nil {
+			return Policies{}, err
+		}
+	}
+	return pol, nil
+}
+
+func normByPolicy(side map[string]any) map[string]map[string]bool {
+	bp, _ := attrs(side, "by-policy")
+	out := make(map[string]map[string]bool, len(bp))
+	for substr, v := range bp {
+		kinds, _ := v.(map[string]any)
+		out[substr] = map[string]bool{
+			KindFiles:    enabled(kinds[KindFiles]),
+			KindSystemd:  enabled(kinds[KindSystemd]),
+			KindPackages: enabled(kinds[KindPackages]),
+		}
+	}
+	return out
+}
+
+// normExplicit ensures every explicit entry is an attrset with a boolean
+// "enable". Includes may be attrsets or booleans, which become {enable = v;};
+// excludes must be booleans, as collect-policies.nix negates them (!!v).
+func normExplicit(side map[string]any, sideName, kind string, exclude bool) (map[string]map[string]any, error) {
+	m, _ := attrs(side, kind)
+	out := make(map[string]map[string]any, len(m))
+	for k, v := range m {
+		entry := map[string]any{}
+		a, isAttrs := v.(map[string]any)
+		if _, isBool := v.(bool); !isBool && (exclude || !isAttrs) {
+			want := "a boolean"
+			if !exclude {
+				want += " or an attrset"
+			}
+			return nil, fmt.Errorf("rx.%s.%s %s: must be %s, got %T", sideName, kind, k, want, v)
+		}
+		for ak, av := range a {
+			entry[ak] = av
+		}
+		entry["enable"] = enabled(v)
+		out[k] = entry
+	}
+	return out, nil
+}
+
+// enabled extracts a boolean from either a bool or an attrset with "enable",
+// like getEnabled in collect-policies.nix.
+func enabled(v any) bool {
+	switch x := v.(type) {
+	case bool:
+		return x
+	case map[string]any:
+		b, _ := x["enable"].(bool)
+		return b
+	}
+	return false
+}
+
+// MatchPolicy reports whether any by-policy rule enabled for kind matches one
+// of originPaths by substring, like policy/match-policy.nix.
+func MatchPolicy(byPolicy map[string]map[string]bool, kind string, originPaths []string) bool {
+	for substr, kinds := range byPolicy {
+		if !kinds[kind] {
+			continue
+		}
+		for _, p := range originPaths {
+			if strings.Contains(p, substr) {
+				return true
+			}
+		}
+	}
+	return false
+}
@@ -0,0 +1,194 @@
+package selection
+
+import (
+	"encoding/json"
+	"reflect"
+	"testing"
+)
+
+// The expectations below are worked out from the Nix functions the package
+// mirrors, match-policy.nix and select-files.nix.
+
+func TestMatchPolicy(t *testing.T) {
+	byPolicy := map[string]map[string]bool{
+		"filesystems.nix": {KindFiles: true},
+		"sshd.nix":        {KindFiles: false, KindSystemd: true},
+	}
+	for _, tc := range []struct {
+		name    string
+		kind    string
+		origins []string
+		want    bool
+	}{
+		{"substring of an origin", KindFiles, []string{"/nix/store/x-source/nixos/modules/tasks/filesystems.nix"}, true},
+		{"any origin matches", KindFiles, []string{"/etc/nixos/configuration.nix", "/x/filesystems.nix"}, true},
+		{"kind not enabled", KindFiles, []string{"/x/sshd.nix"}, false},
+		{"other kind enabled", KindSystemd, []string{"/x/sshd.nix"}, true},
+		{"no origin matches", KindFiles, []string{"/etc/nixos/configuration.nix"}, false},
+		{"no origins", KindFiles, nil, false},
+	} {
+		if got := MatchPolicy(byPolicy, tc.kind, tc.origins); got != tc.want {
+			t.Errorf("%s: MatchPolicy = %v, want %v", tc.name, got, tc.want)
+		}
+	}
+	if MatchPolicy(nil, KindFiles, []string{"/x/filesystems.nix"}) {
+		t.Error("MatchPolicy without rules = true, want false")
+	}
+}
+
+func TestSelectFiles(t *testing.T) {
+	text := func(s string) *string { return &s }
+	for _, tc := range []struct {
+		name string
+		dump string
+		want []FileRecord
+	}{{
+		name: "nothing unless rx.enable",
+		dump: `{"rx": {"files": {"/opt/a": {"text": "a"}}, "include": {"files": {"/etc/hosts": {"enable": true}}}}}`,
+	}, {
+		name: "explicit include takes environment.etc defaults",
+		dump: `{"rx": {"enable": true, "include": {"files": {"/etc/hosts": {"enable": true}, "/etc/motd": {"enable": false}}}},
+			"etc": {"hosts": {"text": "127.0.0.1 localhost\n", "user": "alice", "mode": "0600"}, "motd": {"text": "hi"}}}`,
+		want: []FileRecord{{Path: "/etc/hosts", Owner: "alice", Group: "root", Mode: "0600", EnsureDir: true, Text: text("127.0.0.1 localhost\n")}},
+	}, {
+		name: "include overlays the defaults, rx.files overlays both, nulls are dropped",
+		dump: `{"rx": {"enable": true,
+				"include": {"files": {"/etc/hosts": {"enable": true, "mode": "0640", "owner": null, "group": "wheel"}}},
+				"files": {"/etc/hosts": {"group": "adm", "owner": null}}},
+			"etc": {"hosts": {"text": "x", "user": "alice"}}}`,
+		want: []FileRecord{{Path: "/etc/hosts", Owner: "alice", Group: "adm", Mode: "0640", EnsureDir: true, Text: text("x")}},
+	}, {
+		name: "by-policy include by origin, source then target",
+		dump: `{"rx": {"enable": true, "include": {"by-policy": {"filesystems.nix": {"files": {"enable": true}}, "sshd.nix": {"systemd": true}}}},
+			"etc": {"fstab": {"source": "/nix/store/fstab"}, "crypttab": {"target": "/nix/store/crypttab"}, "ssh/sshd_config": {"text": "x"}},
+			"etcDefinitions": [
+				{"file": "/nix/store/s/nixos/modules/tasks/filesystems.nix", "value": {"fstab": null, "crypttab": null}},
+				{"file": "/nix/store/s/nixos/modules/services/sshd.nix", "value": {"ssh/sshd_config": null}}]}`,
+		want: []FileRecord{
+			{Path: "/etc/crypttab", Owner: "root", Group: "root", Mode: "0644", EnsureDir: true, Source: text("/nix/store/crypttab")},
+			{Path: "/etc/fstab", Owner: "root", Group: "root", Mode: "0644", EnsureDir: true, Source: text("/nix/store/fstab")},
+		},
+	}, {
+		name: "explicit and by-policy excludes win over includes",
+		dump: `{"rx": {"enable": true,
+				"include": {"by-policy": {"filesystems.nix": {"files": true}}, "files": {"/etc/hosts": {"enable": true}, "/etc/motd": {"enable": true}}},
+				"exclude": {"files": {"/etc/hosts": true, "/etc/motd": false}, "by-policy": {"crypt": {"files": true}}}},
+			"etc": {"fstab": {"text": "f"}, "crypttab": {"text": "c"}, "hosts": {"text": "h"}, "motd": {"text": "m"}},
+			"etcDefinitions": [{"file": "/x/filesystems.nix", "value": {"fstab": null}}, {"file": "/x/filesystems.nix", "value": {"crypttab": null}}, {"file": "/x/crypt.nix", "value": {"crypttab": null}}]}`,
+		want: []FileRecord{
+			{Path: "/etc/fstab", Owner: "root", Group: "root", Mode: "0644", EnsureDir: true, Text: text("f")},
+			{Path: "/etc/motd", Owner: "root", Group: "root", Mode: "0644", EnsureDir: true, Text: text("m")},
+		},
+	}, {
+		name: "rx.files outside /etc get no environment.etc defaults nor policy excludes",
+		dump: `{"rx": {"enable": true, "files": {"/opt/app.conf": {"text": "a", "mode": "0600", "ensureDir": false}},
+				"exclude": {"by-policy": {"app": {"files": true}}}},
+			"etcDefinitions": [{"file": "/x/app.nix", "value": {"app.conf": null}}]}`,
+		want: []FileRecord{{Path: "/opt/app.conf", Owner: "root", Group: "root", Mode: "0600", EnsureDir: false, Text: text("a")}},
+	}} {
+		d, err := DecodeDump([]byte(tc.dump))
+		if err != nil {
+			t.Fatalf("%s: %v", tc.name, err)
+		}
+		got, err := SelectFiles(d)
+		if err != nil {
+			t.Errorf("%s: %v", tc.name, err)
+			continue
+		}
+		if !reflect.DeepEqual(got, tc.want) {
+			t.Errorf("%s:\n got %s\nwant %s", tc.name, records(got), records(tc.want))
+		}
+	}
+}
+
+func TestSelectFilesInvalid(t *testing.T) {
+	for name, dump := range map[string]string{
+		"no content":         `{"rx": {"enable": true, "files": {"/opt/a": {}}}}`,
+		"text and source":    `{"rx": {"enable": true, "files": {"/opt/a": {"text": "a", "source": "/b"}}}}`,
+		"generator+value":    `{"rx": {"enable": true, "files": {"/opt/a": {"generator": "g", "value": {}}}}}`,
+		"non-string owner":   `{"rx": {"enable": true, "files": {"/opt/a": {"text": "a", "owner": 0}}}}`,
+		"rx.files not a set": `{"rx": {"enable": true, "files": []}}`,
+		"exclude not a bool": `{"rx": {"enable": true, "files": {"/opt/a": {"text": "a"}}, "exclude": {"files": {"/opt/a": {"enable": true}}}}}`,
+		"include a string":   `{"rx": {"enable": true, "include": {"files": {"/etc/a": "yes"}}}}`,
+	} {
+		d, err := DecodeDump([]byte(dump))
+		if err != nil {
+			t.Fatalf("%s: %v", name, err)
+		}
+		if got, err := SelectFiles(d); err == nil {
+			t.Errorf("%s: expected an error, got %s", name, records(got))
+		}
+	}
+}
+
+// A map of dumps is told from a dump by its values, whatever the hosts are
+// named.
+func TestIsDump(t *testing.T) {
+	for dump, want := range map[string]bool{
+		`{"rx": {"enable": true}, "etcDefinitions": []}`:                true,
+		`{"rx": {"enable": true}}`:                                      true,
+		`{"web": {"rx": {"enable": true}}, "etc": {"rx": {}}}`:          false,
+		`{"rx": {"rx": {"enable": true}, "systemd": {"services": {}}}}`: false,
+	} {
+		var probe map[string]any
+		if err := json.Unmarshal([]byte(dump), &probe); err != nil {
+			t.Fatal(err)
+		}
+		if got := IsDump(probe); got != want {
+			t.Errorf("IsDump(%s) = %v, want %v", dump, got, want)
+		}
+	}
+}
+
+// Services have no Nix selection to mirror yet; see the package doc.
+func TestHostIRServices(t *testing.T) {
+	d, err := DecodeDump([]byte(`{"rx": {"enable": true, "include": {"systemd": {"a": {"enable": true}, "b": true, "c": true}},
+		"exclude": {"systemd": {"c": true}}},
+		"systemd": {"services": {"a": {"enable": true, "wantedBy": ["multi-user.target"]}, "b": {"enable": false}, "c": {}}}}`))
+	if err != nil {
+		t.Fatal(err)
+	}
+	h, err := HostIR(d)
+	if err != nil {
+		t.Fatal(err)
+	}
+	want := map[string]map[string]any{
+		"a": {"state": "running", "startup": "enabled"},
+		"b": {"state": "stopped", "startup": "disabled"},
+	}
+	if !reflect.DeepEqual(h.Res["svc"], want) {
+		t.Errorf("svc resources = %v, want %v", h.Res["svc"], want)
+	}
+}
+
+func TestHostIRSymlinkMode(t *testing.T) {
+	d, err := DecodeDump([]byte(`{"rx": {"enable": true, "include": {"files": {"/etc/hosts": {"enable": true}}}},
+		"etc": {"hosts": {"text": "x", "mode": "symlink"}}}`))
+	if err != nil {
+		t.Fatal(err)
+	}
+	h, err := HostIR(d)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if mode, ok := h.Res["file"]["/etc/hosts"]["mode"]; ok {
+		t.Errorf("mode = %v, want none for a symlink", mode)
+	}
+}
+
+func records(rs []FileRecord) string {
+	s := "["
+	for _, r := range rs {
+		s += "\n  " + r.Path + " " + r.Owner + ":" + r.Group + " " + r.Mode
+		if r.Text != nil {
+			s += " text=" + *r.Text
+		}
+		if r.Source != nil {
+			s += " source=" + *r.Source
+		}
+		if !r.EnsureDir {
+			s += " !ensureDir"
+		}
+	}
+	return s + "]"
+}
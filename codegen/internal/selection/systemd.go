@@ -0,0 +1,57 @@
+package selection
+
+// ServiceRecord is a selected systemd service.
+type ServiceRecord struct {
+	Name     string
+	Enable   bool
+	WantedBy []string
+}
+
+// SelectServices selects the systemd.services to manage. It applies the same
+// rules as SelectFiles: explicit rx.include.systemd entries and services
+// defined in files matching an enabled by-policy rule, minus explicit and
+// by-policy excludes. Records are sorted by name. Unlike the files, this
+// has no Nix counterpart to stay in sync with yet.
+func SelectServices(d Dump) ([]ServiceRecord, error) {
+	if !enabled(d.Rx) {
+		return nil, nil
+	}
+	pol, err := CollectPolicies(d.Rx)
+	if err != nil {
+		return nil, err
+	}
+	svcOrigins := origins(d.SystemdDefinitions)
+
+	included := make(map[string]bool)
+	for name, entry := range pol.Include.Systemd {
+		if entry["enable"] == true {
+			included[name] = true
+		}
+	}
+	for name, paths := range svcOrigins {
+		if MatchPolicy(pol.Include.ByPolicy, KindSystemd, paths) {
+			included[name] = true
+		}
+	}
+
+	var out []ServiceRecord
+	for _, name := range sortedKeys(included) {
+		if pol.Exclude.Systemd[name]["enable"] == true || MatchPolicy(pol.Exclude.ByPolicy, KindSystemd, svcOrigins[name]) {
+			continue
+		}
+		svc := d.Systemd.Services[name]
+		rec := ServiceRecord{Name: name, Enable: true}
+		if b, ok := svc["enable"].(bool); ok {
+			rec.Enable = b
+		}
+		if wb, ok := svc["wantedBy"].([]any); ok {
+			for _, t := range wb {
+				if s, ok := t.(string); ok {
+					rec.WantedBy = append(rec.WantedBy, s)
+				}
+			}
+		}
+		out = append(out, rec)
+	}
+	return out, nil
+}
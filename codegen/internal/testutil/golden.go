@@ -0,0 +1,75 @@
+// Package testutil holds helpers shared by the codegen tests.
+package testutil
+
+import (
+	"flag"
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+var update = flag.Bool("update", false, "rewrite golden files with the current output")
+
+// MgmtFixture is the synthetic mgmt source tree, relative to a package
+// directory under internal/.
+const MgmtFixture = "../../testdata/mgmt"
+
+// Golden compares got with the contents of the golden file at path. With
+// -update, the golden file is (re)written instead.
+func Golden(t *testing.T, path string, got []byte) {
+	t.Helper()
+	if *update {
+		if err := os.MkdirAll(filepath.Dir(path), 0o755); err != nil {
+			t.Fatal(err)
+		}
+		if err := os.WriteFile(path, got, 0o644); err != nil {
+			t.Fatal(err)
+		}
+		return
+	}
+	want, err := os.ReadFile(path)
+	if err != nil {
+		t.Fatalf("read golden file (run with -update to create it): %v", err)
+	}
+	if string(got) != string(want) {
+		t.Errorf("%s differs from the current output (run with -update to accept):\n--- got\n%s\n--- want\n%s", path, got, want)
+	}
+}
+
+// NastyStrings seeds the fuzz targets that render user-controlled strings into
+// generated code: interpolation openers, string delimiters of both languages,
+// escapes, whitespace Nix would strip, non-ASCII text and raw control bytes.
+var NastyStrings = []string{
+	"",
+	"plain",
+	"${",
+	"${x}",
+	"$${x}",
+	"\\${x}",
+	"$",
+	"'",
+	"''",
+	"'''",
+	"''''",
+	"'${x}",
+	"''${x}",
+	"''\\n",
+	"a'$b",
+	"\\",
+	"\\\\",
+	"\"",
+	"\\\"",
+	"\x00",
+	"a\x00b",
+	"\x01\x1b[0m\x7f",
+	"\n",
+	"\r\n",
+	"\t",
+	"  leading",
+	"  \nfirst line blank",
+	"trailing\n  ",
+	"  indented\n  block\n",
+	"ünïcödé ✓ 🚀",
+	"\u2028\u2029\ufeff",
+	"\xff\xfe",
+}
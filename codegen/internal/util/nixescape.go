@@ -2,33 +2,49 @@ package util
 
 import "strings"
 
-// EscapeIndentedNix escapes s so it is safe inside a Nix indented string: ” ... ”.
+// EscapeIndentedNix escapes s so it is safe inside a Nix indented string.
 // For rules see https://nix.dev/manual/nix/latest/language/string-literals
-//  1. "”"  → "”'"
-//  2. "'"   → "”\"
-//  3. "${"  → "”${"
+//
+//	${                     -> ''${
+//	' before ', $ or end   -> ''\'
+//	leading space/newline  -> ''\ / ''\n
+//	trailing blank line    -> last space as ''\
+//
+// Escaping a leading space or newline keeps the opening delimiter from dropping a
+// blank first line and pins the minimum indentation at zero, so Nix strips
+// nothing. NUL bytes cannot be represented in a Nix string and are copied
+// as-is.
 //
 // The algorithm scans left-to-right and never re-scans what it writes.
 func EscapeIndentedNix(s string) string {
 	var b strings.Builder
 	b.Grow(len(s) * 2)
 
-	for i := 0; i < len(s); {
-		// Prevent interpolation: ${ -> ''${
-		if s[i] == '$' && i+1 < len(s) && s[i+1] == '{' {
-			b.WriteString("''${")
-			i += 2
-			continue
+	// Nix drops a final line that consists only of spaces.
+	last := strings.LastIndexByte(s, '\n')
+	blankTail := last >= 0 && last < len(s)-1 && strings.Trim(s[last+1:], " ") == ""
+
+	for i := 0; i < len(s); i++ {
+		c := s[i]
+		var next byte
+		if i+1 < len(s) {
+			next = s[i+1]
 		}
-		// Escape delimiter: '' -> '''
-		if s[i] == '\'' && i+1 < len(s) && s[i+1] == '\'' {
-			b.WriteString("'''")
-			i += 2
-			continue
+		switch {
+		case i == 0 && c == '\n':
+			b.WriteString("''\\n")
+		case (i == 0 || i == len(s)-1 && blankTail) && c == ' ':
+			b.WriteString("''\\ ")
+		case c == '$' && next == '{':
+			// Prevent interpolation; the { follows verbatim.
+			b.WriteString("''$")
+		case c == '\'' && (next == '\'' || next == '$' || i == len(s)-1):
+			// A quote that could pair up with its neighbour or the closing
+			// delimiter is escaped on its own.
+			b.WriteString("''\\'")
+		default:
+			b.WriteByte(c)
 		}
-		// Everything else verbatim (including a single `'`)
-		b.WriteByte(s[i])
-		i++
 	}
 	return b.String()
 }
@@ -40,3 +56,54 @@ func SanitizeAttrIdent(s string) string {
 	s = strings.ReplaceAll(s, ".", "-")
 	return s
 }
+
+// QuoteNixString renders s as a double-quoted Nix string literal.
+func QuoteNixString(s string) string {
+	var b strings.Builder
+	b.Grow(len(s) + 2)
+	b.WriteByte('"')
+	for i := 0; i < len(s); i++ {
+		switch c := s[i]; c {
+		case '"', '\\':
+			b.WriteByte('\\')
+			b.WriteByte(c)
+		case '\n':
+			b.WriteString(`\n`)
+		case '\r':
+			b.WriteString(`\r`)
+		case '\t':
+			b.WriteString(`\t`)
+		case '$':
+			// Prevent interpolation: ${ -> \${
+			if i+1 < len(s) && s[i+1] == '{' {
+				b.WriteByte('\\')
+			}
+			b.WriteByte(c)
+		default:
+			b.WriteByte(c)
+		}
+	}
+	b.WriteByte('"')
+	return b.String()
+}
+
+var nixKeywords = map[string]bool{
+	"assert": true, "else": true, "if": true, "in": true, "inherit": true,
+	"let": true, "or": true, "rec": true, "then": true, "with": true,
+}
+
+// NixAttrName renders s as a Nix attribute name, quoting it unless it is a
+// plain identifier.
+func NixAttrName(s string) string {
+	if s == "" || nixKeywords[s] {
+		return QuoteNixString(s)
+	}
+	for i, r := range s {
+		ok := r == '_' || (r >= 'a' && r <= 'z') || (r >= 'A' && r <= 'Z') ||
+			(i > 0 && (r == '-' || r == '\'' || (r >= '0' && r <= '9')))
+		if !ok {
+			return QuoteNixString(s)
+		}
+	}
+	return s
+}
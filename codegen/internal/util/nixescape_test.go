@@ -0,0 +1,104 @@
+package util
+
+import (
+	"github.com/karpfediem/rx.nix/codegen/internal/testutil"
+	"strings"
+	"testing"
+)
+
+// The expected values are what nix-instantiate --eval prints for each literal.
+func TestDecodeIndentedNix(t *testing.T) {
+	for _, tc := range []struct{ lit, want string }{
+		{"''\n  foo\n    bar\n''", "foo\n  bar\n"},
+		{"''\n  foo\n  ''", "foo\n"},
+		{"''  foo\n  bar''", "foo\nbar"},
+		{"''a'''b''", "a''b"},
+		{"''a''$b''", "a$b"},
+		{"''a''\\nb''", "a\nb"},
+		{"''$''", "$"},
+		{"''$'x''", "$'x"},
+		{"''  ''\\ x\n  y''", " x\ny"},
+		{"''x'y''", "x'y"},
+		{"''\n\n  a\n''", "\na\n"},
+	} {
+		got, err := decodeIndentedNix(tc.lit)
+		if err != nil {
+			t.Errorf("%q: %v", tc.lit, err)
+			continue
+		}
+		if got != tc.want {
+			t.Errorf("%q decoded to %q, want %q", tc.lit, got, tc.want)
+		}
+	}
+	for _, lit := range []string{"''${x}''", "''a''b''", "''a"} {
+		if got, err := decodeIndentedNix(lit); err == nil {
+			t.Errorf("%q decoded to %q, want an error", lit, got)
+		}
+	}
+}
+
+func FuzzEscapeIndentedNix(f *testing.F) {
+	for _, s := range testutil.NastyStrings {
+		f.Add(s)
+	}
+	f.Fuzz(func(t *testing.T, s string) {
+		if strings.IndexByte(s, 0) >= 0 {
+			t.Skip("Nix strings cannot hold NUL")
+		}
+		esc := EscapeIndentedNix(s)
+		// Inline, and as a block the way nixgen emits descriptions.
+		for lit, want := range map[string]string{
+			"''" + esc + "''":     s,
+			"''\n" + esc + "\n''": s + "\n",
+		} {
+			got, err := decodeIndentedNix(lit)
+			if err != nil {
+				t.Fatalf("EscapeIndentedNix(%q) = %q: %v", s, esc, err)
+			}
+			if got != want {
+				t.Fatalf("EscapeIndentedNix(%q) = %q decodes to %q", s, esc, got)
+			}
+		}
+	})
+}
+
+func FuzzQuoteNixString(f *testing.F) {
+	for _, s := range testutil.NastyStrings {
+		f.Add(s)
+	}
+	f.Fuzz(func(t *testing.T, s string) {
+		if strings.IndexByte(s, 0) >= 0 {
+			t.Skip("Nix strings cannot hold NUL")
+		}
+		lit := QuoteNixString(s)
+		got, err := decodeNixString(lit)
+		if err != nil {
+			t.Fatalf("QuoteNixString(%q) = %s: %v", s, lit, err)
+		}
+		if got != s {
+			t.Fatalf("QuoteNixString(%q) = %s decodes to %q", s, lit, got)
+		}
+	})
+}
+
+func FuzzNixAttrName(f *testing.F) {
+	for _, s := range append(testutil.NastyStrings, "in", "a-b", "a'", "_x", "1x") {
+		f.Add(s)
+	}
+	f.Fuzz(func(t *testing.T, s string) {
+		if strings.IndexByte(s, 0) >= 0 {
+			t.Skip("Nix strings cannot hold NUL")
+		}
+		name := NixAttrName(s)
+		if !strings.HasPrefix(name, `"`) {
+			if name != s || nixKeywords[s] {
+				t.Fatalf("NixAttrName(%q) = %s is not the bare name", s, name)
+			}
+			return
+		}
+		got, err := decodeNixString(name)
+		if err != nil || got != s {
+			t.Fatalf("NixAttrName(%q) = %s decodes to %q (%v)", s, name, got, err)
+		}
+	})
+}
@@ -0,0 +1,185 @@
+package util
+
+import (
+	"errors"
+	"fmt"
+	"strings"
+)
+
+// The decoders below follow the string rules of Nix's lexer.l and
+// stripIndentation in parser-tab.y, so the fuzz tests can check escaped
+// output without a nix binary.
+
+var errInterpolation = errors.New("string contains an interpolation")
+
+// decodeNixString decodes a double-quoted Nix string literal.
+func decodeNixString(lit string) (string, error) {
+	if len(lit) < 2 || lit[0] != '"' {
+		return "", fmt.Errorf("not a string literal: %q", lit)
+	}
+	var b strings.Builder
+	for i := 1; i < len(lit); i++ {
+		switch c := lit[i]; {
+		case c == 0:
+			return "", fmt.Errorf("NUL byte at %d", i)
+		case c == '"':
+			if i != len(lit)-1 {
+				return "", fmt.Errorf("text after closing quote at %d", i)
+			}
+			return b.String(), nil
+		case c == '$' && i+1 < len(lit) && lit[i+1] == '{':
+			return "", errInterpolation
+		case c == '\\' && i+1 < len(lit):
+			i++
+			b.WriteByte(unescapeNix(lit[i]))
+		default:
+			b.WriteByte(c)
+		}
+	}
+	return "", fmt.Errorf("unterminated string: %q", lit)
+}
+
+type indPart struct {
+	text   string
+	indent bool // subject to indentation stripping
+}
+
+// decodeIndentedNix decodes a Nix indented string literal, the kind delimited
+// by two single quotes.
+func decodeIndentedNix(lit string) (string, error) {
+	if !strings.HasPrefix(lit, "''") {
+		return "", fmt.Errorf("not an indented string: %q", lit)
+	}
+	i := 2
+	// The opening delimiter swallows a first line of spaces.
+	if j := i + len(lit[i:]) - len(strings.TrimLeft(lit[i:], " ")); j < len(lit) && lit[j] == '\n' {
+		i = j + 1
+	}
+
+	var parts []indPart
+	for {
+		if i >= len(lit) {
+			return "", fmt.Errorf("unterminated indented string: %q", lit)
+		}
+		if strings.IndexByte(lit[i:], 0) == 0 {
+			return "", fmt.Errorf("NUL byte at %d", i)
+		}
+		rest := lit[i:]
+		switch {
+		case strings.HasPrefix(rest, "''$"):
+			parts = append(parts, indPart{text: "$"})
+			i += 3
+		case strings.HasPrefix(rest, "'''"):
+			parts = append(parts, indPart{text: "''"})
+			i += 3
+		case strings.HasPrefix(rest, "''\\") && len(rest) > 3:
+			parts = append(parts, indPart{text: string(unescapeNix(rest[3]))})
+			i += 4
+		case strings.HasPrefix(rest, "''"):
+			if len(rest) != 2 {
+				return "", fmt.Errorf("text after closing delimiter at %d", i)
+			}
+			return stripIndentation(parts), nil
+		case strings.HasPrefix(rest, "${"):
+			return "", errInterpolation
+		default:
+			// ([^$']|\$[^{']|'[^'$])+
+			j := i
+			for j < len(lit) && lit[j] != 0 {
+				c := lit[j]
+				if c != '$' && c != '\'' {
+					j++
+					continue
+				}
+				if j+1 >= len(lit) || lit[j+1] == '\'' || lit[j+1] == '{' && c == '$' || lit[j+1] == '$' && c == '\'' {
+					break
+				}
+				j += 2
+			}
+			if j == i {
+				// A lone $ or ' that cannot start a run.
+				parts = append(parts, indPart{text: rest[:1]})
+				i++
+				continue
+			}
+			parts = append(parts, indPart{text: lit[i:j], indent: true})
+			i = j
+		}
+	}
+}
+
+func stripIndentation(parts []indPart) string {
+	atStartOfLine := true
+	minIndent, curIndent := 1000000, 0
+	for _, p := range parts {
+		if !p.indent {
+			if atStartOfLine {
+				atStartOfLine = false
+				minIndent = min(minIndent, curIndent)
+			}
+			continue
+		}
+		for j := 0; j < len(p.text); j++ {
+			switch c := p.text[j]; {
+			case atStartOfLine && c == ' ':
+				curIndent++
+			case atStartOfLine && c == '\n':
+				curIndent = 0
+			case atStartOfLine:
+				atStartOfLine = false
+				minIndent = min(minIndent, curIndent)
+			case c == '\n':
+				atStartOfLine, curIndent = true, 0
+			}
+		}
+	}
+
+	var out strings.Builder
+	atStartOfLine = true
+	curDropped := 0
+	for n, p := range parts {
+		var s strings.Builder
+		for j := 0; j < len(p.text); j++ {
+			c := p.text[j]
+			switch {
+			case atStartOfLine && c == ' ':
+				if curDropped >= minIndent {
+					s.WriteByte(c)
+				}
+				curDropped++
+			case atStartOfLine && c == '\n':
+				curDropped = 0
+				s.WriteByte(c)
+			case atStartOfLine:
+				atStartOfLine, curDropped = false, 0
+				s.WriteByte(c)
+			default:
+				s.WriteByte(c)
+				if c == '\n' {
+					atStartOfLine = true
+				}
+			}
+		}
+		text := s.String()
+		// Remove the last line if it is empty and consists only of spaces.
+		if n == len(parts)-1 {
+			if k := strings.LastIndexByte(text, '\n'); k >= 0 && strings.Trim(text[k+1:], " ") == "" {
+				text = text[:k+1]
+			}
+		}
+		out.WriteString(text)
+	}
+	return out.String()
+}
+
+func unescapeNix(c byte) byte {
+	switch c {
+	case 'n':
+		return '\n'
+	case 'r':
+		return '\r'
+	case 't':
+		return '\t'
+	}
+	return c
+}
@@ -0,0 +1,20 @@
+// Package hello registers a resource from outside engine/resources.
+package hello
+
+import (
+	mgmt "github.com/purpleidea/mgmt/engine"
+)
+
+func init() {
+	mgmt.RegisterResource("hello", newHello)
+}
+
+func newHello() mgmt.Res {
+	return &HelloRes{Greeting: "hi"}
+}
+
+// HelloRes greets.
+type HelloRes struct {
+	// Greeting is what to say.
+	Greeting string `lang:"greeting"`
+}
@@ -0,0 +1,27 @@
+// Package engine is a trimmed-down stand-in for mgmt's engine package, used
+// as a parser fixture.
+package engine
+
+// Res is the interface every resource implements.
+type Res interface {
+	Default() Res
+	Validate() error
+}
+
+// Init is passed to a resource when it starts.
+type Init struct{}
+
+// RegisterResource registers a new resource kind.
+func RegisterResource(kind string, fn func() Res) {}
+
+const (
+	// PkgKind is registered through a qualified engine constant.
+	PkgKind = "pkg"
+
+	// KVKind is read through an aliased engine import.
+	KVKind = "kv"
+
+	// UserKind resolves through a chain of constants.
+	UserKind = userKind
+	userKind = "user"
+)
@@ -0,0 +1,4 @@
+package resources
+
+// This file intentionally does not parse.
+func broken( {
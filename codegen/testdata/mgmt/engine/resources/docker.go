@@ -0,0 +1,27 @@
+//go:build !nodocker
+
+package resources
+
+import (
+	"github.com/purpleidea/mgmt/engine"
+	"github.com/purpleidea/mgmt/lang/funcs/vars"
+	"github.com/purpleidea/mgmt/lang/interfaces"
+	"github.com/purpleidea/mgmt/lang/types"
+)
+
+func init() {
+	engine.RegisterResource("docker:container", func() engine.Res { return &DockerContainerRes{} })
+
+	// The kind is not an MCL identifier, so this has no $const name.
+	vars.RegisterResourceParams("docker:container", map[string]map[string]func() interfaces.Var{
+		"image": {
+			"latest": func() interfaces.Var { return &types.StrValue{V: "latest"} },
+		},
+	})
+}
+
+// DockerContainerRes is only built without the nodocker tag.
+type DockerContainerRes struct {
+	// Image is the container image.
+	Image string `lang:"image"`
+}
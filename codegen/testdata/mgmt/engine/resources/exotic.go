@@ -0,0 +1,56 @@
+package resources
+
+import (
+	"strings"
+	"time"
+
+	"github.com/purpleidea/mgmt/engine"
+)
+
+func init() {
+	engine.RegisterResource("test:exotic", func() engine.Res {
+		return &ExoticRes{}
+	})
+}
+
+// ExoticRes exercises unusual field types.
+type ExoticRes struct {
+	// Env is passed to the process, for example
+	//
+	//	{"LANG" => "C.UTF-8",}
+	Env     map[string]string   `lang:"env"`
+	Args    map[string][]string `lang:"args"`
+	Limit   *int64              `lang:"limit"`
+	Port    uint16              `lang:"port"` // e.g. 8080, never -1
+	Ratio   float64             `lang:"ratio"`
+	IDs     []int               `lang:"ids"`
+	Matrix  [][]string          `lang:"matrix"`
+	Flag    *bool               `lang:"flag"`
+	Timeout time.Duration       `lang:"timeout"`
+	Any     interface{}         `lang:"any"`
+	Nested  struct {
+		A string
+	} `lang:"nested"`
+	A, B   string `lang:"pair"` // only the first name is used
+	Labels labels `lang:"labels"`
+
+	Untagged string
+}
+
+// labels is a named type only type checking sees through.
+type labels = map[string]string
+
+// Default mixes values that can be evaluated statically with ones that can't.
+func (obj *ExoticRes) Default() engine.Res {
+	flag := true
+	return &ExoticRes{
+		Env:     map[string]string{"LANG": "C"},
+		Limit:   nil,
+		Port:    0x1f90,
+		Ratio:   -1.5,
+		IDs:     []int{1, 2},
+		Flag:    &flag,
+		Timeout: 5 * time.Second,
+		A:       strings.Repeat("a", 2),
+	}
+}
@@ -0,0 +1,133 @@
+package resources
+
+import (
+	"fmt"
+	"strings"
+
+	"github.com/purpleidea/mgmt/engine"
+	"github.com/purpleidea/mgmt/engine/traits"
+	"github.com/purpleidea/mgmt/lang/funcs/vars"
+	"github.com/purpleidea/mgmt/lang/interfaces"
+	"github.com/purpleidea/mgmt/lang/types"
+)
+
+// FileStateExists is the state of a file that should exist.
+const FileStateExists = "exists"
+
+func init() {
+	engine.RegisterResource("file", func() engine.Res { return &FileRes{} })
+
+	// const.res.file.state.exists = "exists"
+	// const.res.file.state.absent = "absent"
+	vars.RegisterResourceParams("file", map[string]map[string]func() interfaces.Var{
+		"state": {
+			FileStateExists: func() interfaces.Var {
+				return &types.StrValue{
+					V: FileStateExists,
+				}
+			},
+			"absent": func() interfaces.Var {
+				return &types.StrValue{V: "absent"}
+			},
+			"computed": func() interfaces.Var {
+				return stateVar()
+			},
+		},
+	})
+}
+
+func stateVar() interfaces.Var { return &types.StrValue{V: "exists"} }
+
+// FileRes is a file and directory resource. Dirs are defined by names ending
+// in a slash.
+type FileRes struct {
+	traits.Base // add the base methods without re-implementation
+	traits.Edgeable
+
+	init *engine.Init
+
+	// Path, which defaults to the name if not specified, represents the
+	// destination path for the file or directory being managed. It must be
+	// an absolute path.
+	Path string `lang:"path" yaml:"path"`
+
+	// Content specifies the file contents to use. If this is nil, they are
+	// left undefined. It cannot be combined with the Source or Fragments
+	// parameters.
+	Content *string `lang:"content" yaml:"content"`
+
+	// Source specifies the source contents for the file resource. It cannot
+	// be combined with the Content or Fragments parameters.
+	Source string `lang:"source" yaml:"source"`
+
+	// Fragments specifies that the file is built from a list of individual
+	// files. It cannot be combined with the Content or Source parameters.
+	Fragments []string `lang:"fragments" yaml:"fragments"`
+
+	// Mode is the mode of the file as a string representation of the octal
+	// form or symbolic form, e.g. "0640" or "u=rw,g=r".
+	Mode string `lang:"mode" yaml:"mode"`
+
+	// Owner specifies the file owner.
+	Owner string `lang:"owner" yaml:"owner"`
+
+	// Recurse specifies if we should descend into directories.
+	Recurse bool `lang:"recurse" yaml:"recurse"`
+
+	// State is one of:
+	//   - "exists", the default
+	//   - "absent", which removes the file
+	//
+	// See https://mgmtconfig.com/docs/resources/ for the *details*.
+	State string `lang:"state" yaml:"state"`
+
+	// sha256sum is an internal cache and has no lang tag.
+	sha256sum string
+}
+
+// Default returns some sensible defaults for this resource.
+func (obj *FileRes) Default() engine.Res {
+	return &FileRes{
+		State: FileStateExists,
+	}
+}
+
+// Validate reports any problems with the struct definition.
+func (obj *FileRes) Validate() error {
+	if obj.Path != "" && !strings.HasPrefix(obj.Path, "/") {
+		return fmt.Errorf("the Path must be absolute")
+	}
+
+	if obj.Content != nil && obj.Source != "" {
+		return fmt.Errorf("can't specify both Content and Source")
+	}
+	if obj.Content != nil && len(obj.Fragments) > 0 || (obj.Source != "" && len(obj.Fragments) > 0) {
+		return fmt.Errorf("can't combine Fragments with Content or Source")
+	}
+
+	if obj.State != FileStateExists && obj.State != "absent" && obj.State != "" {
+		return fmt.Errorf("the State is invalid")
+	}
+
+	// Not expressible on the Nix side: a method call and a formatted error.
+	if obj.isDir() && obj.Content != nil {
+		return fmt.Errorf("can't specify Content when creating a Dir")
+	}
+	if obj.Mode != "" {
+		if _, err := obj.mode(); err != nil {
+			return fmt.Errorf("mode error: %v", err)
+		}
+	}
+
+	return nil
+}
+
+// getPath returns the actual path to use for this resource. It computes this
+// after analysis of the Path and Name.
+func (obj *FileRes) getPath() string {
+	p := obj.Path
+	if obj.Path == "" { // use the name as the path default if missing
+		p = obj.Name()
+	}
+	return p
+}
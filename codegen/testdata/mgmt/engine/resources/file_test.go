@@ -0,0 +1,7 @@
+package resources
+
+import "github.com/purpleidea/mgmt/engine"
+
+func init() {
+	engine.RegisterResource("testonly", func() engine.Res { return &FileRes{} })
+}
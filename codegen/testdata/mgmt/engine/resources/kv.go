@@ -0,0 +1,19 @@
+package resources
+
+import (
+	"github.com/purpleidea/mgmt/engine"
+	e "github.com/purpleidea/mgmt/engine"
+)
+
+func init() {
+	engine.RegisterResource(e.KVKind, func() engine.Res { return &KVRes{} })
+}
+
+// KVRes is registered with a kind constant read through an aliased import.
+type KVRes struct {
+	// Key is the key to set. It is required.
+	Key string `lang:"key"`
+
+	// Value is the value to store.
+	Value *string `lang:"value"`
+}
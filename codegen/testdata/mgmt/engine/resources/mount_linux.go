@@ -0,0 +1,15 @@
+package resources
+
+import (
+	"github.com/purpleidea/mgmt/engine"
+)
+
+func init() {
+	engine.RegisterResource("mount", func() engine.Res { return &MountRes{} })
+}
+
+// MountRes manages a mount point.
+type MountRes struct {
+	// Device is the block device to mount.
+	Device string `lang:"device"`
+}
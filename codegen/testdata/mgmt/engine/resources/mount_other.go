@@ -0,0 +1,17 @@
+//go:build !linux
+
+package resources
+
+import (
+	"github.com/purpleidea/mgmt/engine"
+)
+
+func init() {
+	engine.RegisterResource("mount", func() engine.Res { return &MountRes{} })
+}
+
+// MountRes manages a mount point. Only volumes are supported here.
+type MountRes struct {
+	// Volume is the volume to mount.
+	Volume string `lang:"volume"`
+}
@@ -0,0 +1,17 @@
+package resources
+
+import (
+	"github.com/purpleidea/mgmt/engine"
+)
+
+func init() {
+	engine.RegisterResource("named", newNamed)
+}
+
+func newNamed() engine.Res { return &NamedRes{} }
+
+// NamedRes is registered through a named constructor function.
+type NamedRes struct {
+	// Value is a value.
+	Value string `lang:"value"`
+}
@@ -0,0 +1,15 @@
+package resources
+
+import (
+	eng "github.com/purpleidea/mgmt/engine"
+)
+
+func init() {
+	eng.RegisterResource("net", func() eng.Res { return &NetRes{} })
+}
+
+// NetRes is registered through an aliased engine import.
+type NetRes struct {
+	// Addrs are the interface addresses.
+	Addrs []string `lang:"addrs"`
+}
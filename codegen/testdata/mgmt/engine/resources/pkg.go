@@ -0,0 +1,44 @@
+package resources
+
+import (
+	"errors"
+
+	"github.com/purpleidea/mgmt/engine"
+)
+
+func init() {
+	engine.RegisterResource(engine.PkgKind, func() engine.Res { return &PkgRes{} })
+	engine.RegisterResource(engine.UserKind, func() engine.Res { return &UserRes{} })
+}
+
+/*
+PkgRes is a package resource. The name is the package name.
+*/
+type PkgRes struct {
+	// State is "installed", "uninstalled", "newest" or a version.
+	State string `lang:"state" yaml:"state"`
+
+	// AllowUntrusted permits untrusted packages.
+	AllowUntrusted bool `lang:"AllowUntrusted" yaml:"allowuntrusted"`
+}
+
+// UserRes is a user account resource. Its home directory is not created; use
+// a [FileRes] for that, and a PkgRes for the login shell.
+type UserRes struct {
+	// UID is the user id.
+	UID *uint32 `lang:"uid" yaml:"uid"`
+
+	// Groups lists supplementary groups.
+	Groups []string `lang:"groups" yaml:"groups"`
+
+	// Shadow is the hashed password, as stored in /etc/shadow.
+	Shadow string `lang:"shadow" yaml:"shadow"`
+}
+
+// Validate checks if the resource data structure was populated correctly.
+func (obj *PkgRes) Validate() error {
+	if obj.State == "" {
+		return errors.New("state cannot be empty")
+	}
+	return nil
+}
@@ -0,0 +1,60 @@
+package resources
+
+import (
+	"github.com/purpleidea/mgmt/engine"
+	"github.com/purpleidea/mgmt/engine/traits"
+	"github.com/purpleidea/mgmt/lang/funcs/vars"
+	"github.com/purpleidea/mgmt/lang/interfaces"
+	"github.com/purpleidea/mgmt/lang/types"
+)
+
+const (
+	svcKind = "svc"
+
+	svcStartupUndefined = "undefined"
+)
+
+func init() {
+	engine.RegisterResource(svcKind, func() engine.Res { return &SvcRes{} })
+
+	vars.RegisterResourceParams(svcKind, map[string]map[string]func() interfaces.Var{
+		"state": {
+			"running": func() interfaces.Var { return &types.StrValue{V: "running"} },
+			"stopped": func() interfaces.Var { return &types.StrValue{V: "stopped"} },
+		},
+		// There is no such param.
+		"restart": {
+			"always": func() interfaces.Var { return &types.StrValue{V: "always"} },
+		},
+	})
+}
+
+// SvcRes is a service resource for systemd units. For example:
+//
+//	svc "sshd" {
+//		state => "running",
+//		startup => "enabled",
+//	}
+type SvcRes struct {
+	traits.Base
+
+	// State is the desired state for this resource. Valid values are
+	// "running", "stopped", and "undefined".
+	State string `lang:"state" yaml:"state"`
+
+	// Startup specifies what should happen on startup. Values can be:
+	// "enabled", "disabled", and "undefined".
+	Startup string `lang:"startup" yaml:"startup"`
+
+	// Session is true if this is a user service.
+	Session bool `lang:"session" yaml:"session"`
+}
+
+// Default returns some sensible defaults for this resource.
+func (obj *SvcRes) Default() engine.Res {
+	return &SvcRes{
+		State:   "running",
+		Startup: svcStartupUndefined,
+		Session: false,
+	}
+}
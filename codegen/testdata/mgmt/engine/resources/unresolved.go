@@ -0,0 +1,16 @@
+package resources
+
+import (
+	"github.com/purpleidea/mgmt/engine"
+)
+
+func init() {
+	// Neither is static enough to follow.
+	engine.RegisterResource(computedKind(), func() engine.Res { return &NetRes{} })
+	engine.RegisterResource("dynamic", func() engine.Res {
+		r := &NamedRes{}
+		return r
+	})
+}
+
+func computedKind() string { return "computed" }
@@ -0,0 +1,14 @@
+package resources
+
+import (
+	"github.com/purpleidea/mgmt/engine"
+)
+
+func init() {
+	engine.RegisterResource("untagged", func() engine.Res { return &UntaggedRes{} })
+}
+
+// UntaggedRes has no lang tagged fields.
+type UntaggedRes struct {
+	Value string
+}
@@ -0,0 +1,18 @@
+//go:build !novirt
+
+// Package virt lives in a sub-package of engine/resources.
+package virt
+
+import (
+	"github.com/purpleidea/mgmt/engine"
+)
+
+func init() {
+	engine.RegisterResource("virt", func() engine.Res { return &VirtRes{} })
+}
+
+// VirtRes is a libvirt resource.
+type VirtRes struct {
+	// URI is the libvirt connection URI.
+	URI string `lang:"uri"`
+}
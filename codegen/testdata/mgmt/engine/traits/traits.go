@@ -0,0 +1,8 @@
+// Package traits holds embeddable resource helpers.
+package traits
+
+// Base is embedded by every resource.
+type Base struct{}
+
+// Edgeable is embedded by resources supporting auto edges.
+type Edgeable struct{}
@@ -0,0 +1,32 @@
+package corestrings
+
+import (
+	"github.com/purpleidea/mgmt/lang/funcs/simple"
+	"github.com/purpleidea/mgmt/lang/types"
+)
+
+// ModuleName is the prefix given to all the functions in this module.
+const ModuleName = "golang/strings"
+
+func init() {
+	simple.ModuleRegister(ModuleName, "to_upper", &types.FuncValue{
+		T: types.NewType("func(s str) str"),
+		V: ToUpper,
+	})
+	simple.ModuleRegister(ModuleName, "split", &types.FuncValue{
+		T: types.NewType("func(s str, sep str) []str"),
+		V: Split,
+	})
+	simple.ModuleRegister(ModuleName, "computed", &types.FuncValue{
+		T: signature(),
+		V: ToUpper,
+	})
+}
+
+// ToUpper returns s with all letters mapped to upper case.
+func ToUpper(input []types.Value) (types.Value, error) { return nil, nil }
+
+// Split slices s into all substrings separated by sep.
+func Split(input []types.Value) (types.Value, error) { return nil, nil }
+
+func signature() *types.Type { return types.NewType("func(str) str") }
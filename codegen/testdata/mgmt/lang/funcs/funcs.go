@@ -0,0 +1,11 @@
+// Package funcs is a trimmed-down stand-in for mgmt's function registry,
+// used as a parser fixture.
+package funcs
+
+import "github.com/purpleidea/mgmt/lang/interfaces"
+
+// Register registers a core function.
+func Register(name string, fn func() interfaces.Func) {}
+
+// ModuleRegister registers a function of a module.
+func ModuleRegister(module, name string, fn func() interfaces.Func) {}
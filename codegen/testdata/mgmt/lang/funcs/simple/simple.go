@@ -0,0 +1,16 @@
+// Package simple is a stub of mgmt's registry for pure functions.
+package simple
+
+import "github.com/purpleidea/mgmt/lang/types"
+
+// Scaffold is a pure function and its signature.
+type Scaffold struct {
+	T *types.Type
+	F func([]types.Value) (types.Value, error)
+}
+
+// Register registers a pure core function.
+func Register(name string, fn interface{}) {}
+
+// ModuleRegister registers a pure function of a module.
+func ModuleRegister(module, name string, fn interface{}) {}
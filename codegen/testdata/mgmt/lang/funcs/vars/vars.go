@@ -0,0 +1,9 @@
+// Package vars is a trimmed-down stand-in for mgmt's registry of built-in
+// variables, used as a parser fixture.
+package vars
+
+import "github.com/purpleidea/mgmt/lang/interfaces"
+
+// RegisterResourceParams registers the constants of a resource's params as
+// $const.res.<kind>.<param>.<name>.
+func RegisterResourceParams(kind string, params map[string]map[string]func() interfaces.Var) {}
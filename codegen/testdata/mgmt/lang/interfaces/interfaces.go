@@ -0,0 +1,17 @@
+// Package interfaces is a stub of mgmt's function interfaces.
+package interfaces
+
+import "github.com/purpleidea/mgmt/lang/types"
+
+// Info describes a function.
+type Info struct {
+	Sig *types.Type
+}
+
+// Func is a language function.
+type Func interface {
+	Info() *Info
+}
+
+// Var is a built-in variable.
+type Var interface{}
@@ -0,0 +1,23 @@
+// Package types is a stub of mgmt's language types.
+package types
+
+// Type is a language type.
+type Type struct{}
+
+// Value is a language value.
+type Value interface{}
+
+// FuncValue is a function value, as older trees register them.
+type FuncValue struct {
+	T *Type
+	V func([]Value) (Value, error)
+}
+
+// NewType parses a type signature.
+func NewType(s string) *Type { return &Type{} }
+
+// StrValue is a string value.
+type StrValue struct{ V string }
+
+// IntValue is an int value.
+type IntValue struct{ V int64 }
@@ -76,6 +76,26 @@ in
       })
       systems);
 
+  # A single deploy per system for the whole cluster: main.mcl dispatches on
+  # sys.hostname(), so it can be pushed once via `mgmt deploy`.
+  #   nix build .#rxCluster.x86_64-linux
+  flake.rxCluster =
+    let systems = config.systems or [ "x86_64-linux" ];
+    in lib.genAttrs systems (sys:
+      localFlake.withSystem sys ({ pkgs, ... }:
+        let
+          irByHost = irForSystem sys;
+          moduleDrv = pkgs.callPackage (import ../pkgs/module.nix {
+            deployName = "cluster-${sys}";
+            ir = irByHost;
+            mclArgs = [ "-dispatch" ];
+          }) {
+            rx-codegen = pkgs.callPackage ../pkgs/codegen.nix { };
+          };
+        in
+        pkgs.callPackage ../pkgs/generation.nix { deployName = "cluster-${sys}"; inherit moduleDrv; }
+      ));
+
   # A JSON IR per host, accessible like:  nix build .#rxIR.demo
   flake.rxIR =
     mapAttrs (host: _cfg:
@@ -32,6 +32,15 @@
         {
           _module.args.pkgs = pkgs;
           packages = { inherit (pkgs) rx-codegen rx-nixos-options; };
+          # The checked-in options must match what the codegen generates from
+          # the pinned mgmt; `just generate-nix-module-options` updates them.
+          checks.generated-options = pkgs.runCommand "rx-generated-options-up-to-date" { } ''
+            if ! diff -r ${pkgs.rx-nixos-options} ${./nixos/modules/generated}; then
+              echo "nixos/modules/generated is stale; run: just generate-nix-module-options" >&2
+              exit 1
+            fi
+            touch "$out"
+          '';
         };
 
       systems = [
@@ -8,7 +8,8 @@ in
 pkgs.lib.mapAttrs
   (deployName: ir:
   let
-    moduleDrv = pkgs'.callPackage (import ../../pkgs/module.nix { inherit ir deployName; }) { };
+    # The whole document, so that collects see the other hosts' exports.
+    moduleDrv = pkgs'.callPackage (import ../../pkgs/module.nix { inherit deployName; document = irByHost; }) { };
   in
   pkgs.callPackage ../../pkgs/generation.nix { inherit deployName moduleDrv; }
   )
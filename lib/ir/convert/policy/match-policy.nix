@@ -1,6 +1,7 @@
 { lib }:
 # Decide whether a resource with given originPaths matches a set of "by-policy"
 # rules for a given kind ("files" | "systemd" | "packages").
+# Mirrored in Go by codegen/internal/selection (keep both in sync).
 #
 # Usage:
 #   let matchPolicy = import ./policy/match-policy.nix { inherit lib; };
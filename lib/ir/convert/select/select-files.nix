@@ -1,5 +1,6 @@
 { lib }:
 # Select and synthesize the whitelisted /etc files + arbitrary rx.files to manage.
+# Mirrored in Go by codegen/internal/selection (keep both in sync).
 #
 # Inputs:
 #   nixosCfg   : evaluated nixos system for a host
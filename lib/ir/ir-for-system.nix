@@ -32,12 +32,18 @@ mapAttrs
       mclVars    = (cfg.rx.mcl.vars    or {});
       mclRaw     = (cfg.rx.mcl.raw     or []);
       rxRes      = (cfg.rx.res         or {});
+      rxExport   = (cfg.rx.export      or {});
+      rxCollect  = (cfg.rx.collect     or []);
+      secretKey  = (cfg.rx.mgmt.secretKeyFile or null);
   in
     {
+      hostname = cfg.networking.hostName or "";
       imports = unique (["deploy"] ++ mclImports);
       vars    = mclVars;
       raw     = mclRaw;
       res     = rxRes;
-    }
+      export  = rxExport;
+      collect = map (c: lib.filterAttrs (_: v: v != null) c) rxCollect;
+    } // lib.optionalAttrs (secretKey != null) { inherit secretKey; }
   )
   hosts
@@ -30,7 +30,7 @@ let
     inherit allHosts;
   };
 
-  buildGens = import ./build/build-gens.nix;
+  buildGens = import ./build/build-per-host-deploys.nix;
 
 in
 assert assertMsg (hostSystem != null)
@@ -42,7 +42,8 @@ withSystem hostSystem ({ pkgs, ... }:
 
     irDrv = pkgs.writeText "rx-ir-${host}.json" (builtins.toJSON hostIR);
 
-    gens   = buildGens { inherit pkgs; irByHost = { ${host} = hostIR; }; };
+    # Every host of the system, so that this host's collects resolve.
+    gens   = buildGens { inherit pkgs irByHost; };
     genDrv = gens.${host};
 
     switchApp = {
@@ -4,6 +4,7 @@
     ./modules/mgmt.nix
     ./modules/generated
     ./modules/mcl
+    ./modules/exchange
     ./modules/files
   ];
 }
@@ -0,0 +1,50 @@
+{ lib, ... }:
+let
+  inherit (lib) mkOption types;
+in
+{
+  # Exported/collected resources across hosts (mgmt Meta:export + collect).
+  options.rx.export = mkOption {
+    type = types.attrsOf (types.attrsOf (types.listOf types.str));
+    default = { };
+    example = { file."/etc/ssh/ssh_known_hosts.d/web" = [ "*" ]; };
+    description = ''
+      Map of resource kind -> rx.res instance name -> hosts the resource is
+      exported to (rendered as `Meta:export`). Use "*" to export to every host.
+      The resource itself must be defined under `rx.res.<kind>.<name>`.
+    '';
+  };
+
+  options.rx.collect = mkOption {
+    type = types.listOf (types.submodule (_: {
+      options = {
+        kind = mkOption {
+          type = types.str;
+          description = "mgmt resource kind to collect, e.g. \"file\".";
+        };
+        name = mkOption {
+          type = types.nullOr types.str;
+          default = null;
+          description = "Resource name to collect. If null, every exported resource of `kind` is collected.";
+        };
+        from = mkOption {
+          type = types.listOf types.str;
+          default = [ ];
+          description = "Hosts to collect from. If empty, any exporting host is accepted.";
+        };
+        params = mkOption {
+          type = types.attrsOf types.anything;
+          default = { };
+          description = "Params applied to the collected resources.";
+        };
+      };
+    }));
+    default = [ ];
+    description = ''
+      Resources exported by other hosts that this host collects. Deploys
+      built from the IR of every host check that each collect has at least
+      one exporter; a host built on its own can only collect when both
+      `name` and `from` are set.
+    '';
+  };
+}
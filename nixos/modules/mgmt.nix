@@ -28,6 +28,10 @@ let
       vars = mcl.vars or { };
       raw = mcl.raw or [ ];
       res = (rx.res or { });
+      export = (rx.export or { });
+      collect = map (c: lib.filterAttrs (_: v: v != null) c) (rx.collect or [ ]);
+    } // lib.optionalAttrs (cfg.secretKeyFile != null) {
+      secretKey = cfg.secretKeyFile;
     };
 
   # ---- 2) Build deploy derivation for this host ----
@@ -37,6 +41,14 @@ let
   # ---- 3) Scripts embedded into the generation output ----
   rxGeneration = pkgs.callPackage ../../pkgs/generation.nix { inherit deployName moduleDrv; };
 
+  # Encrypted secrets are decrypted before mgmt sees a deploy: on switching
+  # to it, before the profile moves, and when the service starts, as they
+  # live in /run.
+  decryptSecrets = pkgs.callPackage ../../pkgs/decrypt-secrets.nix { };
+  decryptCmd = deploy:
+    optionalString (cfg.secretKeyFile != null)
+      "${decryptSecrets}/bin/rx-decrypt-secrets ${deploy} ${escapeShellArg cfg.secretKeyFile}";
+
   rxSwitchPkg = pkgs.writeShellApplication {
     name = "rx-switch";
     runtimeInputs = with pkgs; [
@@ -48,13 +60,15 @@ let
     text = ''
       set -euo pipefail
       GEN=${escapeShellArg rxGeneration}
+      ${decryptCmd "\"$GEN/deploy\""}
       exec "$GEN/switch-to-configuration" "$GEN"
     '';
   };
 
   # PATH pieces from user-provided packages.
-  extraBinPath = makeBinPath cfg.path;
-  extraSbinPath = makeSearchPath "sbin" cfg.path;
+  unitPath = cfg.path;
+  extraBinPath = makeBinPath unitPath;
+  extraSbinPath = makeSearchPath "sbin" unitPath;
 
   extraPkgPath =
     concatStringsSep ":" (lib.filter (s: s != "") [ extraBinPath extraSbinPath ]);
@@ -164,6 +178,17 @@ in
       default = null;
       description = "Override persistent data directory for mgmt runtime state.";
     };
+
+    secretKeyFile = mkOption {
+      type = types.nullOr types.str;
+      default = null;
+      example = "/var/lib/rx/age.key";
+      description = ''
+        Path on the host of the age identity used to decrypt `age` and `sops`
+        secrets in rx.res, when switching to a deploy and when mgmt starts.
+        A string, not a path, so the key is never copied into the Nix store.
+      '';
+    };
   };
 
   config = mkIf cfg.enable (mkMerge [
@@ -189,6 +214,23 @@ in
               Set rx.mgmt.noNetwork = false when using external etcd/seeding.
             '';
           }
+          {
+            # /run/rx/secrets is only writable by root.
+            assertion = cfg.secretKeyFile == null || cfg.user == null;
+            message = ''
+              rx.mgmt.secretKeyFile needs the system service; encrypted secrets
+              can't be decrypted for a user service (rx.mgmt.user).
+            '';
+          }
+          {
+            # This module only sees its own host, so it can't look up exporters.
+            assertion = lib.all (c: c.name != null && c.from != [ ]) (config.rx.collect or [ ]);
+            message = ''
+              rx.collect entries need both name and from when the host is built on
+              its own by rx.mgmt; collects without them are resolved by the flake's
+              per-host deploys, which see the exports of every host.
+            '';
+          }
         ];
     }
 
@@ -199,7 +241,7 @@ in
     }
 
     # Provide rx-switch command
-    { environment.systemPackages = [ rxSwitchPkg ]; }
+    { environment.systemPackages = [ rxSwitchPkg ] ++ lib.optional (cfg.secretKeyFile != null) decryptSecrets; }
     # Provide packages in system closure (prevent download during no-network activation scripts)
     # These need to include the runtime deps of the switcher scripts
     {
@@ -233,6 +275,7 @@ in
 
         serviceConfig = {
           Type = "simple";
+          ExecStartPre = mkIf (cfg.secretKeyFile != null) (decryptCmd "${cfg.profilePath}/deploy");
           ExecStart = mgmtExec;
 
           # mgmt is a configuration management tool. It will very likely need to read and modify the real filesystem.
@@ -6,6 +6,7 @@ buildGoModule {
   subPackages = [
     "cmd/nixos"
     "cmd/mcl"
+    "cmd/mcl2nix"
   ];
   vendorHash = null;
 }
@@ -0,0 +1,49 @@
+# Decrypts the encrypted secrets a deploy ships in files/secrets/ into
+# /run/rx/secrets/, where the generated MCL reads them with os.readfile.
+# mgmt can't do this itself, as it evaluates functions before running any
+# resource, so rx.mgmt runs this before a deploy reaches mgmt.
+#
+# usage: rx-decrypt-secrets <deploy dir> <key file>
+#
+# A payload is named after its content and provider (<hash>.age,
+# <hash>.sops), so one decrypted earlier is kept. Payloads the key can't
+# decrypt, such as other hosts' in a whole-cluster deploy, are reported and
+# skipped.
+{ pkgs
+, age
+, sops
+, coreutils-full
+}: pkgs.writeShellApplication {
+  name = "rx-decrypt-secrets";
+  runtimeInputs = [
+    age
+    sops
+    coreutils-full
+  ];
+  text = ''
+    set -euo pipefail
+
+    DEPLOY="''${1:?usage: rx-decrypt-secrets <deploy dir> <key file>}"
+    KEY="''${2:?usage: rx-decrypt-secrets <deploy dir> <key file>}"
+    OUT=/run/rx/secrets
+
+    umask 077
+    mkdir -p "$OUT"
+    for payload in "$DEPLOY"/files/secrets/*; do
+      [ -e "$payload" ] || continue
+      name="$(basename "$payload")"
+      [ -e "$OUT/$name" ] && continue
+      case "$name" in
+        *.age) decrypt=(age --decrypt --identity "$KEY" "$payload") ;;
+        *.sops) decrypt=(env SOPS_AGE_KEY_FILE="$KEY" sops --decrypt --input-type binary --output-type binary "$payload") ;;
+        *) continue ;;
+      esac
+      if "''${decrypt[@]}" > "$OUT/$name.tmp"; then
+        mv "$OUT/$name.tmp" "$OUT/$name"
+      else
+        rm -f "$OUT/$name.tmp"
+        printf 'rx-decrypt-secrets: cannot decrypt %s, skipped\n' "$payload" >&2
+      fi
+    done
+  '';
+}
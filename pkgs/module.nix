@@ -1,7 +1,20 @@
 # Build mgmt module (deploy dir) from IR; the codegen decides shape and filenames.
-{ deployName, ir }:
-{ stdenvNoCC, callPackage, rx-codegen ? callPackage ./codegen.nix {} }:
+# mclArgs are extra flags for the mcl codegen (e.g. [ "-dispatch" ] for whole-cluster IR).
+# manifest types resource params; it is written by cmd/nixos next to the generated options.
+# document, if set, is the IR of every host deployName is rendered with, so that
+# its collects resolve against the other hosts' exports; ir is then unused.
+{ deployName, ir ? null, document ? null, mclArgs ? [ ], manifest ? ../nixos/modules/generated/manifest.json }:
+{ lib, stdenvNoCC, callPackage, rx-codegen ? callPackage ./codegen.nix {} }:
 
+let
+  # Without the manifest, map and struct params can't be told apart; this
+  # means nixos/modules/generated is out of date.
+  manifestArgs =
+    if builtins.pathExists manifest then [ "-manifest" "${manifest}" ]
+    else lib.warn "rx: ${toString manifest} is missing, params are rendered untyped; run `just generate-nix-module-options`" [ ];
+  input = if document == null then ir else document;
+  hostArgs = lib.optionals (document != null) [ "-host" deployName ];
+in
 stdenvNoCC.mkDerivation {
   pname = "rx-module-${deployName}";
   version = "0.1.0";
@@ -13,10 +26,10 @@ stdenvNoCC.mkDerivation {
     set -euo pipefail
     mkdir -p "$out/deploy"
     cat > "ir.json" <<'JSON'
-${builtins.toJSON ir}
+${builtins.toJSON input}
 JSON
     # Let codegen produce <host>.mcl files into deploy/
-    ${rx-codegen}/bin/mcl -in ir.json -out "$out/deploy"
+    ${rx-codegen}/bin/mcl -in ir.json -out "$out/deploy" ${lib.escapeShellArgs (manifestArgs ++ hostArgs ++ mclArgs)}
     # Optional: if you still want a metadata stub
     cat > "$out/deploy/metadata.yaml" <<'YAML'
 # empty metadata is fine; main.mcl + files/ are the defaults
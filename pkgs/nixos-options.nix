@@ -1,4 +1,7 @@
-{ fetchFromGitHub, runCommand, rx-codegen }:
+# strict fails the build on any parse diagnostic instead of only logging it.
+# tags are the build tags of the mgmt package deployed (e.g. [ "novirt" ]), so
+# that the options only cover the resources built into it.
+{ lib, fetchFromGitHub, runCommand, rx-codegen, strict ? false, tags ? [ ] }:
 let
   mgmtSrc = fetchFromGitHub {
     owner = "purpleidea";
@@ -13,6 +16,7 @@ runCommand "rx-nixos-options" { nativeBuildInputs = [ rx-codegen ]; } ''
   export CGO_ENABLED=0 GOOS=linux GOARCH=amd64
   ${rx-codegen}/bin/nixos \
     -mgmt-dir ${mgmtSrc} \
-    -out-dir "$out"
+    -out-dir "$out" \
+    -tags ${lib.escapeShellArg (lib.concatStringsSep "," tags)} ${lib.optionalString strict "-strict"}
   test -f "$out/default.nix"
 ''